@@ -6,21 +6,31 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/rancher/gitwatcher/pkg/certs"
 	"github.com/rancher/gitwatcher/pkg/controllers/webhook"
+	"github.com/rancher/gitwatcher/pkg/crds"
+	"github.com/rancher/gitwatcher/pkg/health"
 	"github.com/rancher/gitwatcher/pkg/hooks"
 	"github.com/rancher/gitwatcher/pkg/types"
 	"github.com/rancher/wrangler/pkg/leader"
 	"github.com/rancher/wrangler/pkg/signals"
+	"github.com/rancher/wrangler/pkg/start"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+const (
+	leaseName = "rio-gitwatcher"
+)
+
 var (
 	Version   = "v0.0.0-dev"
 	GitCommit = "HEAD"
@@ -39,8 +49,71 @@ func main() {
 			Name:  "listen-address",
 			Value: ":8888",
 		},
+		cli.StringFlag{
+			Name:  "journal-dir",
+			Usage: "Directory to keep validated webhook deliveries in for replay, empty disables the journal",
+		},
+		cli.IntFlag{
+			Name:  "journal-size",
+			Usage: "Number of webhook deliveries kept in the journal",
+			Value: 100,
+		},
+		cli.StringFlag{
+			Name:   "replay-token",
+			EnvVar: "REPLAY_TOKEN",
+			Usage:  "Bearer token authenticating requests to the /replay endpoint, empty disables it",
+		},
+		cli.IntFlag{
+			Name:  "queue-size",
+			Usage: "Number of validated webhook deliveries queued for asynchronous handling and answered with 202 before they're handled, 0 handles them within the request",
+		},
+		cli.IntFlag{
+			Name:  "queue-workers",
+			Usage: "Number of workers handling queued webhook deliveries",
+			Value: 4,
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "Certificate file to serve the receiver over TLS with, reloaded when it changes",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "Private key file of --tls-cert",
+		},
+		cli.StringFlag{
+			Name:  "tls-secret",
+			Usage: "TLS Secret in NAMESPACE to serve the receiver with instead of --tls-cert, a self-signed certificate is generated when it doesn't exist",
+		},
+		cli.StringSliceFlag{
+			Name:  "tls-hosts",
+			Usage: "Host names and IPs the self-signed certificate of --tls-secret is valid for, defaults to localhost",
+		},
+		cli.BoolFlag{
+			Name:   "manage-crds",
+			EnvVar: "MANAGE_CRDS",
+			Usage:  "Create the GitWatcher and GitCommit CRDs when missing and keep their printer columns up to date",
+		},
 	}
 	app.Action = run
+	app.Commands = []cli.Command{
+		{
+			Name:      "replay",
+			Usage:     "List journaled webhook deliveries, or replay the given ones",
+			ArgsUsage: "[DELIVERY_ID...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "url",
+					Usage: "URL of the gitwatcher receiver",
+					Value: "http://localhost:8888",
+				},
+				cli.StringFlag{
+					Name:   "replay-token",
+					EnvVar: "REPLAY_TOKEN",
+				},
+			},
+			Action: replay,
+		},
+	}
 
 	if err := app.Run(os.Args); err != nil {
 		logrus.Fatal(err)
@@ -58,24 +131,119 @@ func run(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if c.Bool("manage-crds") {
+		if err := crds.Apply(restConfig); err != nil {
+			return err
+		}
+	}
 	ctx, rioContext := types.BuildContext(ctx, namespace, restConfig)
 
+	status := health.NewStatus(leaseName)
 	go func() {
-		leader.RunOrDie(ctx, namespace, "rio-gitwatcher", rioContext.K8s, func(ctx context.Context) {
+		leader.RunOrDie(ctx, namespace, leaseName, rioContext.K8s, func(ctx context.Context) {
 			if err := webhook.Register(ctx, rioContext); err != nil {
 				panic(err)
 			}
 			runtime.Must(rioContext.Start(ctx))
+			status.SetLeader(true)
 			<-ctx.Done()
+			status.SetLeader(false)
 		})
 	}()
 
+	opts := hooks.Options{
+		ReplayToken:  c.String("replay-token"),
+		QueueSize:    c.Int("queue-size"),
+		QueueWorkers: c.Int("queue-workers"),
+	}
+	if dir := c.String("journal-dir"); dir != "" {
+		opts.Journal, err = hooks.NewJournal(dir, c.Int("journal-size"))
+		if err != nil {
+			return err
+		}
+	}
+
+	reloader, err := tlsReloader(c, rioContext)
+	if err != nil {
+		return err
+	}
+
+	opts.Health = status
 	addr := c.String("listen-address")
-	logrus.Infof("Listening on %s", addr)
-	handler := hooks.HandleHooks(rioContext)
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: hooks.HandleHooks(ctx, rioContext, opts),
+	}
+
+	// every replica serves webhooks, so the caches the receiver reads from are started here
+	// rather than only by the leader running the controllers
+	go func() {
+		if err := start.Sync(ctx, rioContext.Webhook, rioContext.Core); err != nil {
+			logrus.Errorf("Failed to sync caches: %v", err)
+			return
+		}
+		status.SetSynced()
+	}()
+	if reloader != nil {
+		reloader.Start(ctx)
+		server.TLSConfig = &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+		}
+		logrus.Infof("Listening on %s with TLS", addr)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		logrus.Infof("Listening on %s", addr)
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		logrus.Fatalf("Failed to listen on %s: %v", addr, err)
 	}
 	<-ctx.Done()
 	return nil
 }
+
+func tlsReloader(c *cli.Context, rioContext *types.Context) (*certs.Reloader, error) {
+	certFile, keyFile := c.String("tls-cert"), c.String("tls-key")
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("--tls-cert and --tls-key have to be set together")
+		}
+		return certs.NewFileReloader(certFile, keyFile)
+	case c.String("tls-secret") != "":
+		hosts := c.StringSlice("tls-hosts")
+		if len(hosts) == 0 {
+			hosts = []string{"localhost"}
+		}
+		secrets := rioContext.K8s.CoreV1().Secrets(rioContext.Namespace)
+		return certs.NewSecretReloader(secrets, c.String("tls-secret"), hosts)
+	}
+	return nil, nil
+}
+
+func replay(c *cli.Context) error {
+	client := &hooks.ReplayClient{
+		URL:   c.String("url"),
+		Token: c.String("replay-token"),
+	}
+
+	if c.NArg() == 0 {
+		deliveries, err := client.List()
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			fmt.Printf("%s\t%s\t%s\n", delivery.ID, delivery.Received.Format(time.RFC3339), delivery.RequestURI)
+		}
+		return nil
+	}
+
+	for _, id := range c.Args() {
+		result, err := client.Replay(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%d\t%s\n", result.ID, result.Code, result.Message)
+	}
+	return nil
+}
@@ -10,6 +10,12 @@ const (
 	GitWebHookReceiverConditionRegistered   condition.Cond = "Registered"
 	GitWebHookExecutionConditionInitialized condition.Cond = "Initialized"
 	GitWebHookExecutionConditionHandled     condition.Cond = "Handled"
+
+	// GitWatcherConditionReady is True while the last poll, hook registration and webhook delivery succeeded
+	GitWatcherConditionReady condition.Cond = "Ready"
+
+	// GitWatcherRotateTokenAnnotation requests a new webhook token whenever its value changes
+	GitWatcherRotateTokenAnnotation = "gitwatcher.cattle.io/rotate-token"
 )
 
 // +genclient
@@ -38,6 +44,50 @@ type GitWatcherSpec struct {
 	ExecutionLabels                map[string]string `json:"executionLabels,omitempty"`
 	Enabled                        bool              `json:"enabled,omitempty"`
 	GithubDeployment               bool              `json:"githubDeployment,omitempty"`
+	GithubEnterpriseURL            string            `json:"githubEnterpriseUrl,omitempty"`
+	Generic                        *GenericWebhook   `json:"generic,omitempty"`
+	// TokenRotationInterval rotates the webhook token on a schedule, such as 720h
+	TokenRotationInterval string `json:"tokenRotationInterval,omitempty"`
+	// GithubChecks reports every GitCommit as a check run, which needs GitHub App credentials
+	GithubChecks bool `json:"githubChecks,omitempty"`
+	// GithubCommitStatus reports every GitCommit as a status of its commit
+	GithubCommitStatus bool `json:"githubCommitStatus,omitempty"`
+	// Commands lets pull request comments run slash commands such as /retest
+	Commands *CommentCommands `json:"commands,omitempty"`
+	// BranchInclude and BranchExclude filter the branches pushes and polling create GitCommits for.
+	// Entries are globs, such as release/*, or regexps when enclosed in slashes, such as /^v[0-9]+$/
+	BranchInclude []string `json:"branchInclude,omitempty"`
+	BranchExclude []string `json:"branchExclude,omitempty"`
+	// IncludePaths and ExcludePaths are globs, such as services/api/**, a push or poll only creates a
+	// GitCommit when it changed a file matching IncludePaths, or any file when empty, that doesn't
+	// match ExcludePaths. Changed files missing from a delivery are looked up through the provider API,
+	// deliveries of the generic provider aren't filtered.
+	IncludePaths []string `json:"includePaths,omitempty"`
+	ExcludePaths []string `json:"excludePaths,omitempty"`
+}
+
+// CommentCommands are the slash commands pull request comments may start with, each one creates a
+// GitCommit for the head of the pull request
+type CommentCommands struct {
+	// Allowed lists the commands without their leading slash, such as retest and deploy
+	Allowed []string `json:"allowed,omitempty"`
+	// AuthorAssociations of commenters allowed to run commands, OWNER, MEMBER and COLLABORATOR when empty
+	AuthorAssociations []string `json:"authorAssociations,omitempty"`
+}
+
+// GenericWebhook describes how the generic provider validates deliveries and reads GitCommit
+// fields out of their JSON payload
+type GenericWebhook struct {
+	// Scheme is hmac, where SignatureHeader carries the HMAC of the payload keyed with the
+	// GitWatcher token, or token, where SignatureHeader carries the token itself
+	Scheme          string `json:"scheme,omitempty"`
+	SignatureHeader string `json:"signatureHeader,omitempty"`
+	// JSONPath expressions, such as {.head_commit.id}, selecting GitCommit fields from the payload
+	CommitPath  string `json:"commitPath,omitempty"`
+	BranchPath  string `json:"branchPath,omitempty"`
+	TagPath     string `json:"tagPath,omitempty"`
+	AuthorPath  string `json:"authorPath,omitempty"`
+	MessagePath string `json:"messagePath,omitempty"`
 }
 
 // +genclient
@@ -52,29 +102,63 @@ type GitCommit struct {
 }
 
 type GitCommitSpec struct {
-	Action         string `json:"action,omitempty"`
-	Payload        string `json:"payload,omitempty"`
-	GitWatcherName string `json:"gitWatcherName,omitempty"`
-	Commit         string `json:"commit,omitempty"`
-	Branch         string `json:"branch,omitempty"`
-	Tag            string `json:"tag,omitempty"`
-	PR             string `json:"pr,omitempty"`
-	Merged         bool   `json:"merged,omitempty"`
-	Closed         bool   `json:"closed,omitempty"`
-	SourceLink     string `json:"sourceLink,omitempty"`
-	RepositoryURL  string `json:"repositoryUrl,omitempty"`
-	Title          string `json:"title,omitempty"`
-	Message        string `json:"message,omitempty"`
-	Author         string `json:"author,omitempty"`
-	AuthorEmail    string `json:"authorEmail,omitempty"`
-	AuthorAvatar   string `json:"authorAvatar,omitempty"`
+	Action string `json:"action,omitempty"`
+	// Payload is the raw body of the delivery, stored in the ConfigMap named by PayloadConfigMapName
+	// instead when it is too large to keep inline
+	Payload              string `json:"payload,omitempty"`
+	PayloadConfigMapName string `json:"payloadConfigMapName,omitempty"`
+	EventType            string `json:"eventType,omitempty"`
+	DeliveryID           string `json:"deliveryId,omitempty"`
+	GitWatcherName       string `json:"gitWatcherName,omitempty"`
+	Commit               string `json:"commit,omitempty"`
+	Branch               string `json:"branch,omitempty"`
+	Tag                  string `json:"tag,omitempty"`
+	PR                   string `json:"pr,omitempty"`
+	Merged               bool   `json:"merged,omitempty"`
+	Closed               bool   `json:"closed,omitempty"`
+	SourceLink           string `json:"sourceLink,omitempty"`
+	RepositoryURL        string `json:"repositoryUrl,omitempty"`
+	Title                string `json:"title,omitempty"`
+	Message              string `json:"message,omitempty"`
+	Author               string `json:"author,omitempty"`
+	AuthorEmail          string `json:"authorEmail,omitempty"`
+	AuthorAvatar         string `json:"authorAvatar,omitempty"`
+	// Command is the slash command, without its slash, of the pull request comment the GitCommit was
+	// created for, followed by its arguments
+	Command     string   `json:"command,omitempty"`
+	CommandArgs []string `json:"commandArgs,omitempty"`
+	// ChangedFiles are the files changed by the push or since the previous poll, they are only
+	// recorded when the GitWatcher filters paths
+	ChangedFiles []string `json:"changedFiles,omitempty"`
 }
 
 type GitWatcherStatus struct {
-	Conditions  []Condition `json:"conditions,omitempty"`
-	Token       string      `json:"token,omitempty"`
-	HookID      string      `json:"hookId,omitempty"`
-	FirstCommit string      `json:"firstCommit,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Token and PreviousToken are stored in the Secret named by TokenSecretName, values left
+	// here by older releases are moved there on the next reconcile
+	Token       string `json:"token,omitempty"`
+	HookID      string `json:"hookId,omitempty"`
+	FirstCommit string `json:"firstCommit,omitempty"`
+	// PreviousToken is still accepted until PreviousTokenExpiry so deliveries signed before a
+	// rotation don't fail validation
+	PreviousToken        string `json:"previousToken,omitempty"`
+	PreviousTokenExpiry  string `json:"previousTokenExpiry,omitempty"`
+	TokenRotated         string `json:"tokenRotated,omitempty"`
+	TokenRotationRequest string `json:"tokenRotationRequest,omitempty"`
+	TokenSecretName      string `json:"tokenSecretName,omitempty"`
+	// LastCommit is the commit of the newest GitCommit created for the GitWatcher, at LastCommitTime
+	LastCommit     string `json:"lastCommit,omitempty"`
+	LastCommitTime string `json:"lastCommitTime,omitempty"`
+	LastPolledTime string `json:"lastPolledTime,omitempty"`
+	// LastPolledCommit is the head of the branch at LastPolledTime, the next poll filters the paths
+	// changed since
+	LastPolledCommit string `json:"lastPolledCommit,omitempty"`
+	// LastWebhookDeliveryResult is the response code, and error if any, of the delivery handled at
+	// LastWebhookDeliveryTime
+	LastWebhookDeliveryTime   string `json:"lastWebhookDeliveryTime,omitempty"`
+	LastWebhookDeliveryResult string `json:"lastWebhookDeliveryResult,omitempty"`
+	// ObservedGeneration is the generation of the GitWatcher the status was last reconciled for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 type GithubStatus struct {
@@ -90,6 +174,39 @@ type GitCommitStatus struct {
 	AppliedStatus string        `json:"appliedStatus,omitempty"`
 	BuildStatus   string        `json:"buildStatus,omitempty"`
 	GithubStatus  *GithubStatus `json:"githubStatus,omitempty"`
+	// CheckOutput is reported in the GitHub check run of the GitCommit, it is filled in by whoever
+	// handles the GitCommit
+	CheckOutput *CheckOutput    `json:"checkOutput,omitempty"`
+	CheckRun    *CheckRunStatus `json:"checkRun,omitempty"`
+}
+
+// CheckOutput is the output of the GitHub check run reporting a GitCommit
+type CheckOutput struct {
+	Title   string `json:"title,omitempty"`
+	Summary string `json:"summary,omitempty"`
+	Text    string `json:"text,omitempty"`
+	// Annotations are posted once, with the update completing the check run
+	Annotations []CheckAnnotation `json:"annotations,omitempty"`
+}
+
+// CheckAnnotation points the reader of a check run at lines of a file
+type CheckAnnotation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	// Level is notice, warning or failure
+	Level   string `json:"level,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message"`
+}
+
+// CheckRunStatus is the GitHub check run reporting a GitCommit as it was last posted
+type CheckRunStatus struct {
+	ID         int64  `json:"id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Conclusion string `json:"conclusion,omitempty"`
+	// Hash covers everything posted, the check run is only updated again when it changes
+	Hash string `json:"hash,omitempty"`
 }
 
 type Condition struct {
@@ -24,6 +24,85 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckAnnotation) DeepCopyInto(out *CheckAnnotation) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckAnnotation.
+func (in *CheckAnnotation) DeepCopy() *CheckAnnotation {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckAnnotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckOutput) DeepCopyInto(out *CheckOutput) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make([]CheckAnnotation, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckOutput.
+func (in *CheckOutput) DeepCopy() *CheckOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckRunStatus) DeepCopyInto(out *CheckRunStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckRunStatus.
+func (in *CheckRunStatus) DeepCopy() *CheckRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CommentCommands) DeepCopyInto(out *CommentCommands) {
+	*out = *in
+	if in.Allowed != nil {
+		in, out := &in.Allowed, &out.Allowed
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AuthorAssociations != nil {
+		in, out := &in.AuthorAssociations, &out.AuthorAssociations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CommentCommands.
+func (in *CommentCommands) DeepCopy() *CommentCommands {
+	if in == nil {
+		return nil
+	}
+	out := new(CommentCommands)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Condition) DeepCopyInto(out *Condition) {
 	*out = *in
@@ -40,12 +119,28 @@ func (in *Condition) DeepCopy() *Condition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenericWebhook) DeepCopyInto(out *GenericWebhook) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenericWebhook.
+func (in *GenericWebhook) DeepCopy() *GenericWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(GenericWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitCommit) DeepCopyInto(out *GitCommit) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -104,6 +199,16 @@ func (in *GitCommitList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitCommitSpec) DeepCopyInto(out *GitCommitSpec) {
 	*out = *in
+	if in.CommandArgs != nil {
+		in, out := &in.CommandArgs, &out.CommandArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ChangedFiles != nil {
+		in, out := &in.ChangedFiles, &out.ChangedFiles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -130,6 +235,16 @@ func (in *GitCommitStatus) DeepCopyInto(out *GitCommitStatus) {
 		*out = new(GithubStatus)
 		**out = **in
 	}
+	if in.CheckOutput != nil {
+		in, out := &in.CheckOutput, &out.CheckOutput
+		*out = new(CheckOutput)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CheckRun != nil {
+		in, out := &in.CheckRun, &out.CheckRun
+		*out = new(CheckRunStatus)
+		**out = **in
+	}
 	return
 }
 
@@ -214,6 +329,36 @@ func (in *GitWatcherSpec) DeepCopyInto(out *GitWatcherSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.Generic != nil {
+		in, out := &in.Generic, &out.Generic
+		*out = new(GenericWebhook)
+		**out = **in
+	}
+	if in.Commands != nil {
+		in, out := &in.Commands, &out.Commands
+		*out = new(CommentCommands)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BranchInclude != nil {
+		in, out := &in.BranchInclude, &out.BranchInclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BranchExclude != nil {
+		in, out := &in.BranchExclude, &out.BranchExclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IncludePaths != nil {
+		in, out := &in.IncludePaths, &out.IncludePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludePaths != nil {
+		in, out := &in.ExcludePaths, &out.ExcludePaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
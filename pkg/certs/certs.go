@@ -0,0 +1,203 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/rancher/wrangler/pkg/ticker"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	reloadInterval = 30 * time.Second
+	selfSignedTTL  = 365 * 24 * time.Hour
+)
+
+// Reloader serves the certificate most recently loaded from its source, picking up a renewed
+// certificate without restarting the listener
+type Reloader struct {
+	// load returns the current certificate, or nil when the source didn't change since the last call
+	load func() (*tls.Certificate, error)
+	cert atomic.Value
+}
+
+func newReloader(load func() (*tls.Certificate, error)) (*Reloader, error) {
+	r := &Reloader{
+		load: load,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewFileReloader serves the key pair in certFile and keyFile, reloading it when either file changes
+func NewFileReloader(certFile, keyFile string) (*Reloader, error) {
+	var lastMod time.Time
+	return newReloader(func() (*tls.Certificate, error) {
+		mod, err := latestModTime(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if !mod.After(lastMod) {
+			return nil, nil
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		lastMod = mod
+		return &cert, nil
+	})
+}
+
+// NewSecretReloader serves the key pair in the kubernetes.io/tls Secret name, creating it with a
+// self-signed certificate for hosts when it doesn't exist, and reloading it when the Secret changes
+func NewSecretReloader(secrets v1.SecretInterface, name string, hosts []string) (*Reloader, error) {
+	var resourceVersion string
+	return newReloader(func() (*tls.Certificate, error) {
+		secret, err := secrets.Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			secret, err = createSelfSigned(secrets, name, hosts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if secret.ResourceVersion == resourceVersion {
+			return nil, nil
+		}
+
+		cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pair in secret %s: %v", name, err)
+		}
+		resourceVersion = secret.ResourceVersion
+		return &cert, nil
+	})
+}
+
+// Start polls the certificate source until ctx is done
+func (r *Reloader) Start(ctx context.Context) {
+	go func() {
+		for range ticker.Context(ctx, reloadInterval) {
+			if err := r.reload(); err != nil {
+				logrus.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+			}
+		}
+	}()
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load().(*tls.Certificate), nil
+}
+
+func (r *Reloader) reload() error {
+	cert, err := r.load()
+	if err != nil || cert == nil {
+		return err
+	}
+	r.cert.Store(cert)
+	logrus.Info("Loaded TLS certificate")
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func createSelfSigned(secrets v1.SecretInterface, name string, hosts []string) (*corev1.Secret, error) {
+	certPEM, keyPEM, err := selfSigned(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Generating self-signed TLS certificate for %v in secret %s", hosts, name)
+	secret, err := secrets.Create(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	})
+	if errors.IsAlreadyExists(err) {
+		// another replica created it first
+		return secrets.Get(name, metav1.GetOptions{})
+	}
+	return secret, err
+}
+
+func selfSigned(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: "gitwatcher",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedTTL),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/github"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// updateCheckRun reports a GitCommit of a GitWatcher with GithubChecks enabled as a check run, in
+// progress until the GitCommit is handled and carrying the CheckOutput set on it
+func (w *webhookHandler) updateCheckRun(key string, obj *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
+	if obj == nil || obj.DeletionTimestamp != nil || obj.Spec.Commit == "" {
+		return obj, nil
+	}
+
+	gitwatcher, err := w.gitWatcherCache.Get(obj.Namespace, obj.Spec.GitWatcherName)
+	if errors.IsNotFound(err) {
+		return obj, nil
+	} else if err != nil {
+		return obj, err
+	}
+	if !gitwatcher.Spec.GithubChecks || !w.isGitHub(gitwatcher) {
+		return obj, nil
+	}
+
+	githubClient, err := w.githubClient(gitwatcher)
+	if err != nil {
+		return obj, err
+	}
+	updated, err := github.SyncCheckRun(w.ctx, githubClient, gitwatcher, obj)
+	if err != nil {
+		w.recorder.Eventf(obj, corev1.EventTypeWarning, provider.EventCheckRunFailed, "Failed to report check run: %v", err)
+		return obj, err
+	}
+	if updated == obj {
+		return obj, nil
+	}
+	return w.gitCommits.Update(updated)
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	github2 "github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/github"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// updateCommitStatus reports the outcome of handling a GitCommit of a GitWatcher with
+// GithubCommitStatus enabled as the status of its commit. The state posted is kept in AppliedStatus so it is only posted once.
+func (w *webhookHandler) updateCommitStatus(key string, obj *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
+	if obj == nil || obj.DeletionTimestamp != nil || obj.Spec.Commit == "" {
+		return obj, nil
+	}
+
+	state := github.CommitState(obj)
+	if state == "" || state == obj.Status.AppliedStatus {
+		return obj, nil
+	}
+
+	gitwatcher, err := w.gitWatcherCache.Get(obj.Namespace, obj.Spec.GitWatcherName)
+	if errors.IsNotFound(err) {
+		return obj, nil
+	} else if err != nil {
+		return obj, err
+	}
+	if !gitwatcher.Spec.GithubCommitStatus || !w.isGitHub(gitwatcher) {
+		return obj, nil
+	}
+
+	githubClient, err := w.githubClient(gitwatcher)
+	if err != nil {
+		return obj, err
+	}
+	if err := github.CreateCommitStatus(w.ctx, githubClient, gitwatcher, obj, state); err != nil {
+		w.recorder.Eventf(obj, corev1.EventTypeWarning, provider.EventCommitStatusFailed, "Failed to set commit status to %s: %v", state, err)
+		return obj, err
+	}
+
+	obj = obj.DeepCopy()
+	obj.Status.AppliedStatus = state
+	return w.gitCommits.Update(obj)
+}
+
+// isGitHub checks whether the GitHub provider handles gitwatcher
+func (w *webhookHandler) isGitHub(gitwatcher *webhookv1.GitWatcher) bool {
+	for _, p := range w.providers {
+		if p.Supports(gitwatcher) {
+			_, ok := p.(*github.GitHub)
+			return ok
+		}
+	}
+	return false
+}
+
+func (w *webhookHandler) githubClient(gitwatcher *webhookv1.GitWatcher) (*github2.Client, error) {
+	secretName, err := github.GetWebhookSecretName(gitwatcher)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := w.secretCache.Get(gitwatcher.Namespace, secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	return github.NewClient(w.ctx, w.httpClient, gitwatcher, secret)
+}
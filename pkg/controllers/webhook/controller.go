@@ -12,38 +12,66 @@ import (
 	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
 	webhookcontrollerv1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
 	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/azuredevops"
+	"github.com/rancher/gitwatcher/pkg/provider/bitbucket"
+	"github.com/rancher/gitwatcher/pkg/provider/generic"
+	"github.com/rancher/gitwatcher/pkg/provider/gitea"
 	"github.com/rancher/gitwatcher/pkg/provider/github"
+	"github.com/rancher/gitwatcher/pkg/provider/gitlab"
 	"github.com/rancher/gitwatcher/pkg/provider/polling"
 	"github.com/rancher/gitwatcher/pkg/types"
 	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/pkg/ticker"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
 	refreshInterval = 30
+	// resyncInterval is how often registered hooks are compared with the remote repository
+	resyncInterval = 300
+
+	// reasonHookDrift marks a Registered condition failed by a hook that couldn't be reconciled
+	reasonHookDrift = "HookDrift"
 )
 
 func Register(ctx context.Context, rContext *types.Context) error {
 	secretsLister := rContext.Core.Core().V1().Secret().Cache()
+	configMaps := rContext.Core.Core().V1().ConfigMap()
 
 	wh := webhookHandler{
 		ctx:             ctx,
 		gitWatcherCache: rContext.Webhook.Gitwatcher().V1().GitWatcher().Cache(),
 		gitWatcher:      rContext.Webhook.Gitwatcher().V1().GitWatcher(),
+		gitCommits:      rContext.Webhook.Gitwatcher().V1().GitCommit(),
 		httpClient:      http.DefaultClient,
+		secrets:         rContext.Core.Core().V1().Secret(),
 		secretCache:     rContext.Core.Core().V1().Secret().Cache(),
+		recorder:        rContext.Recorder,
+		reconciled:      newReconciled(),
 	}
 
 	apply := rContext.Apply.WithCacheTypes(
 		rContext.Webhook.Gitwatcher().V1().GitWatcher(),
 		rContext.Webhook.Gitwatcher().V1().GitCommit())
-	wh.providers = append(wh.providers, github.NewGitHub(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister))
-	wh.providers = append(wh.providers, polling.NewPolling(secretsLister, apply))
+	wh.providers = append(wh.providers, github.NewGitHub(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, gitlab.NewGitLab(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, bitbucket.NewBitbucket(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, bitbucket.NewBitbucketServer(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, gitea.NewGitea(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, azuredevops.NewAzureDevOps(apply, rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, generic.NewGeneric(rContext.Webhook.Gitwatcher().V1().GitCommit(), wh.gitWatcher, secretsLister, configMaps, rContext.Recorder))
+	wh.providers = append(wh.providers, polling.NewPolling(secretsLister, rContext.Webhook.Gitwatcher().V1().GitCommit().Cache(), apply, rContext.Recorder))
 
 	rContext.Webhook.Gitwatcher().V1().GitWatcher().OnChange(ctx, "webhook-receiver", wh.onChange)
+	rContext.Webhook.Gitwatcher().V1().GitWatcher().OnRemove(ctx, "webhook-receiver", wh.onRemove)
 	rContext.Webhook.Gitwatcher().V1().GitCommit().OnChange(ctx, "gitcommit-github-deployment-status", wh.updateGithubStatus)
+	rContext.Webhook.Gitwatcher().V1().GitCommit().OnChange(ctx, "gitcommit-last-commit", wh.updateLastCommit)
+	rContext.Webhook.Gitwatcher().V1().GitCommit().OnChange(ctx, "gitcommit-github-commit-status", wh.updateCommitStatus)
+	rContext.Webhook.Gitwatcher().V1().GitCommit().OnChange(ctx, "gitcommit-github-check-run", wh.updateCheckRun)
 
 	wh.start()
 	return nil
@@ -53,29 +81,56 @@ type webhookHandler struct {
 	ctx             context.Context
 	gitWatcher      webhookcontrollerv1.GitWatcherController
 	gitWatcherCache webhookcontrollerv1.GitWatcherCache
+	gitCommits      webhookcontrollerv1.GitCommitController
+	secrets         corev1controller.SecretController
 	secretCache     corev1controller.SecretCache
 	providers       []provider.Provider
 	httpClient      *http.Client
+	recorder        record.EventRecorder
+	reconciled      *reconciled
 }
 
 func (w *webhookHandler) onChange(key string, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
-	if obj == nil {
-		return nil, nil
+	if obj == nil || obj.DeletionTimestamp != nil {
+		return obj, nil
+	}
+	if w.reconciled.upToDate(key, obj, time.Now()) {
+		return obj, nil
 	}
 
-	for _, provider := range w.providers {
-		if provider.Supports(obj) {
-			newObj, err := provider.Create(w.ctx, obj.DeepCopy())
+	for _, p := range w.providers {
+		if p.Supports(obj) {
+			loaded, err := provider.LoadTokens(w.secretCache, obj)
+			if err != nil {
+				return obj, err
+			}
+			newObj, err := p.Create(w.ctx, loaded.DeepCopy())
+			w.recordCreate(p, obj, newObj, err)
+			if err == nil && obj.Status.HookID != "" && w.reconciled.generationChanged(key, obj) {
+				// Create leaves registered hooks alone, so spec changes are applied to them here
+				newObj, err = w.reconcile(p, obj, newObj)
+			}
+			if rotator, ok := p.(provider.TokenRotator); ok && err == nil {
+				newObj, err = w.rotateToken(rotator, newObj)
+			}
+			newObj, err = w.saveTokens(newObj, err)
 			if err != nil {
 				webhookv1.GitWebHookReceiverConditionRegistered.SetError(newObj, "", err)
 			}
+			setReady(p, newObj, err)
+			if next := provider.NextTokenChange(newObj, time.Now()); next > 0 {
+				w.gitWatcher.EnqueueAfter(obj.Namespace, obj.Name, next)
+			}
 			if reflect.DeepEqual(obj, newObj) {
+				w.remember(p, key, obj, err)
 				return obj, err
 			}
+			newObj.Status.ObservedGeneration = obj.Generation
 			updated, updateErr := w.gitWatcher.Update(newObj)
 			if updateErr != nil {
 				return obj, updateErr
 			}
+			w.remember(p, key, updated, err)
 			return updated, err
 		}
 	}
@@ -83,6 +138,128 @@ func (w *webhookHandler) onChange(key string, obj *webhookv1.GitWatcher) (*webho
 	return obj, nil
 }
 
+// reconcile brings the hook registered for obj in line with its spec, recreating it when it's
+// missing from the repository. Providers that can't reconcile hooks leave newObj as it is.
+func (w *webhookHandler) reconcile(p provider.Provider, obj, newObj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	reconciler, ok := p.(provider.HookReconciler)
+	if !ok {
+		return newObj, nil
+	}
+
+	newObj, err := reconciler.Reconcile(w.ctx, newObj)
+	if err == nil {
+		if newObj.Status.HookID != obj.Status.HookID {
+			w.recorder.Eventf(obj, corev1.EventTypeNormal, provider.EventHookCreated, "Recreated webhook %s missing from the repository", newObj.Status.HookID)
+		}
+		clearHookDrift(obj, newObj)
+	}
+	return newObj, err
+}
+
+// remember records that obj was reconciled, so updates to its status alone don't reconcile it again.
+// Polling watchers are left out as they are reconciled to poll, and failures and watchers without a
+// hook yet to be retried.
+func (w *webhookHandler) remember(p provider.Provider, key string, obj *webhookv1.GitWatcher, err error) {
+	if _, ok := p.(*polling.Polling); ok || err != nil || obj.Status.HookID == "" {
+		w.reconciled.forget(key)
+		return
+	}
+	w.reconciled.remember(key, obj, time.Now())
+}
+
+// setReady marks a GitWatcher with a registered hook ready, until a delivery fails. Polling sets
+// readiness from the outcome of each poll itself.
+func setReady(p provider.Provider, obj *webhookv1.GitWatcher, err error) {
+	if _, ok := p.(*polling.Polling); ok {
+		return
+	}
+
+	switch {
+	case err != nil:
+		webhookv1.GitWatcherConditionReady.SetError(obj, provider.EventHookCreateFailed, err)
+	case webhookv1.GitWatcherConditionReady.GetReason(obj) != provider.ReasonDeliveryFailed:
+		webhookv1.GitWatcherConditionReady.SetError(obj, "", nil)
+	}
+}
+
+// recordCreate reports registering the hook of obj as an Event, polling reports its own outcome
+func (w *webhookHandler) recordCreate(p provider.Provider, obj, newObj *webhookv1.GitWatcher, err error) {
+	if _, ok := p.(*polling.Polling); ok {
+		return
+	}
+
+	switch {
+	case err != nil:
+		w.recorder.Eventf(obj, corev1.EventTypeWarning, provider.EventHookCreateFailed, "Failed to register webhook: %v", err)
+	case obj.Status.HookID == "" && newObj.Status.HookID != "":
+		w.recorder.Eventf(obj, corev1.EventTypeNormal, provider.EventHookCreated, "Registered webhook %s", newObj.Status.HookID)
+	}
+}
+
+// saveTokens moves the tokens of obj into its token secret. When that fails they stay inline so a
+// freshly registered hook isn't lost, and are migrated on the next reconcile.
+func (w *webhookHandler) saveTokens(obj *webhookv1.GitWatcher, err error) (*webhookv1.GitWatcher, error) {
+	saved, saveErr := provider.SaveTokens(w.secrets, obj)
+	if saveErr != nil {
+		if err == nil {
+			err = saveErr
+		}
+		return obj, err
+	}
+	return saved, err
+}
+
+// rotateToken drops an expired previous token and rotates the token when the rotate annotation
+// changed or the rotation interval elapsed
+func (w *webhookHandler) rotateToken(rotator provider.TokenRotator, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	now := time.Now()
+	obj = provider.ExpirePreviousToken(obj, now)
+
+	due, err := provider.RotationDue(obj, now)
+	if err != nil || !due {
+		return obj, err
+	}
+	return rotator.RotateToken(w.ctx, obj)
+}
+
+// onRemove deletes the hook a provider registered for obj, the finalizer keeps obj around until it succeeds
+func (w *webhookHandler) onRemove(key string, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	w.reconciled.forget(key)
+	for _, provider := range w.providers {
+		if provider.Supports(obj) {
+			return obj, provider.Remove(w.ctx, obj)
+		}
+	}
+
+	return obj, nil
+}
+
+// updateLastCommit keeps the commit of the newest GitCommit in the status of its GitWatcher, for
+// polling and webhook deliveries alike
+func (w *webhookHandler) updateLastCommit(key string, obj *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
+	if obj == nil || obj.DeletionTimestamp != nil || obj.Spec.GitWatcherName == "" {
+		return obj, nil
+	}
+
+	gitWatcher, err := w.gitWatcherCache.Get(obj.Namespace, obj.Spec.GitWatcherName)
+	if errors.IsNotFound(err) {
+		return obj, nil
+	} else if err != nil {
+		return obj, err
+	}
+
+	created := obj.CreationTimestamp.Time
+	if last, err := time.Parse(time.RFC3339, gitWatcher.Status.LastCommitTime); err == nil && !created.After(last) {
+		return obj, nil
+	}
+
+	gitWatcher = gitWatcher.DeepCopy()
+	gitWatcher.Status.LastCommit = obj.Spec.Commit
+	gitWatcher.Status.LastCommitTime = created.UTC().Format(time.RFC3339)
+	_, err = w.gitWatcher.Update(gitWatcher)
+	return obj, err
+}
+
 func (w *webhookHandler) updateGithubStatus(key string, obj *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
 	if obj == nil || obj.DeletionTimestamp != nil {
 		return obj, nil
@@ -97,18 +274,11 @@ func (w *webhookHandler) updateGithubStatus(key string, obj *webhookv1.GitCommit
 		return obj, err
 	}
 
-	secretName, err := github.GetWebhookSecretName(gitwatcher)
+	githubClient, err := w.githubClient(gitwatcher)
 	if err != nil {
 		return obj, err
 	}
 
-	secret, err := w.secretCache.Get(obj.Namespace, secretName)
-	if err != nil {
-		return nil, err
-	}
-
-	githubClient := github.NewGithubClient(w.ctx, w.httpClient, string(secret.Data["accessToken"]))
-
 	env := "production"
 	if obj.Spec.PR != "" {
 		env = "staging"
@@ -137,6 +307,7 @@ func (w *webhookHandler) updateGithubStatus(key string, obj *webhookv1.GitCommit
 		LogURL:         &obj.Status.GithubStatus.LogURL,
 	})
 	if err != nil {
+		w.recorder.Eventf(obj, corev1.EventTypeWarning, provider.EventDeploymentStatusFailed, "Failed to update deployment %d to %s: %v", obj.Status.GithubStatus.DeploymentID, state, err)
 		return obj, err
 	}
 	defer resp.Body.Close()
@@ -146,7 +317,9 @@ func (w *webhookHandler) updateGithubStatus(key string, obj *webhookv1.GitCommit
 		if err != nil {
 			return obj, err
 		}
-		return obj, fmt.Errorf("failed to create deployment status, code: %v, error: %v", resp.StatusCode, msg)
+		err = fmt.Errorf("failed to create deployment status, code: %v, error: %v", resp.StatusCode, msg)
+		w.recorder.Eventf(obj, corev1.EventTypeWarning, provider.EventDeploymentStatusFailed, "Failed to update deployment %d to %s: %v", obj.Status.GithubStatus.DeploymentID, state, err)
+		return obj, err
 	}
 	return obj, nil
 }
@@ -164,4 +337,73 @@ func (w *webhookHandler) start() {
 			}
 		}
 	}()
+
+	go func() {
+		for range ticker.Context(w.ctx, resyncInterval*time.Second) {
+			w.reconcileHooks()
+		}
+	}()
+}
+
+// reconcileHooks repairs registered hooks that drifted on the remote repository, the outcome is
+// reported on the Registered condition
+func (w *webhookHandler) reconcileHooks() {
+	gitWatchers, err := w.gitWatcherCache.List("", labels.Everything())
+	if err != nil {
+		logrus.Errorf("failed to list gitwatchers for hook resync: %v", err)
+		return
+	}
+
+	for _, obj := range gitWatchers {
+		if obj.Status.HookID == "" || obj.DeletionTimestamp != nil {
+			continue
+		}
+		if err := w.reconcileHook(obj); err != nil {
+			logrus.Errorf("failed to reconcile hook for gitwatcher %s/%s: %v", obj.Namespace, obj.Name, err)
+		}
+	}
+}
+
+// clearHookDrift marks newObj registered again once the hook reported drifting on obj is in sync,
+// keeping the message the reconciler left about repairing it
+func clearHookDrift(obj, newObj *webhookv1.GitWatcher) {
+	if webhookv1.GitWebHookReceiverConditionRegistered.GetReason(newObj) != reasonHookDrift {
+		return
+	}
+	message := webhookv1.GitWebHookReceiverConditionRegistered.GetMessage(newObj)
+	if message == webhookv1.GitWebHookReceiverConditionRegistered.GetMessage(obj) {
+		message = ""
+	}
+	webhookv1.GitWebHookReceiverConditionRegistered.SetError(newObj, "", nil)
+	webhookv1.GitWebHookReceiverConditionRegistered.Message(newObj, message)
+}
+
+func (w *webhookHandler) reconcileHook(obj *webhookv1.GitWatcher) error {
+	for _, p := range w.providers {
+		if !p.Supports(obj) {
+			continue
+		}
+		if _, ok := p.(provider.HookReconciler); !ok {
+			return nil
+		}
+
+		loaded, err := provider.LoadTokens(w.secretCache, obj)
+		if err != nil {
+			return err
+		}
+		newObj, err := w.reconcile(p, obj, loaded.DeepCopy())
+		newObj, err = w.saveTokens(newObj, err)
+		if err != nil {
+			webhookv1.GitWebHookReceiverConditionRegistered.SetError(newObj, reasonHookDrift, err)
+		}
+		if reflect.DeepEqual(obj, newObj) {
+			return err
+		}
+		if _, updateErr := w.gitWatcher.Update(newObj); updateErr != nil {
+			return updateErr
+		}
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	webhookcontrollerv1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeGitWatchers struct {
+	webhookcontrollerv1.GitWatcherController
+}
+
+func (f *fakeGitWatchers) Update(obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	obj = obj.DeepCopy()
+	obj.Generation++
+	return obj, nil
+}
+
+func (f *fakeGitWatchers) EnqueueAfter(namespace, name string, duration time.Duration) {}
+
+// fakeProvider has a registered hook it reconciles against the spec
+type fakeProvider struct {
+	reconciled int
+}
+
+func (f *fakeProvider) Supports(obj *webhookv1.GitWatcher) bool {
+	return true
+}
+
+func (f *fakeProvider) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	return obj, nil
+}
+
+func (f *fakeProvider) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	return nil
+}
+
+func (f *fakeProvider) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeProvider) Reconcile(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	f.reconciled++
+	return obj, nil
+}
+
+func TestOnChangeReconcilesSpecChanges(t *testing.T) {
+	p := &fakeProvider{}
+	w := &webhookHandler{
+		ctx:        context.Background(),
+		gitWatcher: &fakeGitWatchers{},
+		providers:  []provider.Provider{p},
+		recorder:   record.NewFakeRecorder(10),
+		reconciled: newReconciled(),
+	}
+
+	obj := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "watcher",
+			Namespace:  "default",
+			Generation: 1,
+		},
+		Spec: webhookv1.GitWatcherSpec{
+			Push: true,
+		},
+		Status: webhookv1.GitWatcherStatus{
+			HookID: "1",
+		},
+	}
+
+	steps := []struct {
+		name       string
+		change     func(obj *webhookv1.GitWatcher)
+		reconciled int
+	}{
+		{
+			name:       "first reconcile",
+			change:     func(obj *webhookv1.GitWatcher) {},
+			reconciled: 1,
+		},
+		{
+			name:       "unchanged",
+			change:     func(obj *webhookv1.GitWatcher) {},
+			reconciled: 1,
+		},
+		{
+			name: "spec changed",
+			change: func(obj *webhookv1.GitWatcher) {
+				obj.Spec.Tag = true
+				obj.Generation++
+			},
+			reconciled: 2,
+		},
+	}
+
+	for _, step := range steps {
+		obj = obj.DeepCopy()
+		step.change(obj)
+		updated, err := w.onChange("default/watcher", obj)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", step.name, err)
+		}
+		if p.reconciled != step.reconciled {
+			t.Errorf("%s: expected the hook to be reconciled %d times, got %d", step.name, step.reconciled, p.reconciled)
+		}
+		obj = updated
+	}
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+)
+
+// reconciled remembers what onChange last acted on for each GitWatcher, so updates that only record
+// deliveries, commits or polls in the status don't run its provider again
+type reconciled struct {
+	lock   sync.Mutex
+	inputs map[string]reconciledInputs
+}
+
+type reconciledInputs struct {
+	fingerprint string
+	generation  int64
+	// due is when the token of the GitWatcher has to change, the GitWatcher is reconciled again then
+	due time.Time
+}
+
+func newReconciled() *reconciled {
+	return &reconciled{
+		inputs: map[string]reconciledInputs{},
+	}
+}
+
+// upToDate reports whether obj was reconciled as it is, and nothing about it has become due since
+func (r *reconciled) upToDate(key string, obj *webhookv1.GitWatcher, now time.Time) bool {
+	r.lock.Lock()
+	inputs, ok := r.inputs[key]
+	r.lock.Unlock()
+
+	if !ok || (!inputs.due.IsZero() && !now.Before(inputs.due)) {
+		return false
+	}
+	return inputs.fingerprint == fingerprint(obj)
+}
+
+// generationChanged reports whether obj changed since it was last reconciled, or wasn't reconciled
+// since the controller started
+func (r *reconciled) generationChanged(key string, obj *webhookv1.GitWatcher) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	inputs, ok := r.inputs[key]
+	return !ok || inputs.generation != obj.Generation
+}
+
+func (r *reconciled) remember(key string, obj *webhookv1.GitWatcher, now time.Time) {
+	inputs := reconciledInputs{
+		fingerprint: fingerprint(obj),
+		generation:  obj.Generation,
+	}
+	if next := provider.NextTokenChange(obj, now); next > 0 {
+		inputs.due = now.Add(next)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.inputs[key] = inputs
+}
+
+func (r *reconciled) forget(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.inputs, key)
+}
+
+// fingerprint covers everything about obj onChange acts on, leaving out the status fields written
+// as deliveries, commits and polls are recorded
+func fingerprint(obj *webhookv1.GitWatcher) string {
+	status := obj.Status.DeepCopy()
+	status.Conditions = nil
+	status.LastCommit = ""
+	status.LastCommitTime = ""
+	status.LastPolledTime = ""
+	status.LastPolledCommit = ""
+	status.LastWebhookDeliveryTime = ""
+	status.LastWebhookDeliveryResult = ""
+	status.ObservedGeneration = 0
+
+	data, _ := json.Marshal(struct {
+		Annotations map[string]string           `json:"annotations"`
+		Spec        webhookv1.GitWatcherSpec    `json:"spec"`
+		Status      *webhookv1.GitWatcherStatus `json:"status"`
+	}{
+		Annotations: obj.Annotations,
+		Spec:        obj.Spec,
+		Status:      status,
+	})
+	return string(data)
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconciled(t *testing.T) {
+	now := time.Now()
+	reconciledObj := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watcher",
+			Namespace: "default",
+		},
+		Spec: webhookv1.GitWatcherSpec{
+			RepositoryURL: "https://github.com/rancher/gitwatcher",
+			Enabled:       true,
+		},
+		Status: webhookv1.GitWatcherStatus{
+			HookID: "1",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		change   func(obj *webhookv1.GitWatcher)
+		at       time.Time
+		upToDate bool
+	}{
+		{
+			name:     "unchanged",
+			change:   func(obj *webhookv1.GitWatcher) {},
+			at:       now,
+			upToDate: true,
+		},
+		{
+			name: "delivery recorded",
+			change: func(obj *webhookv1.GitWatcher) {
+				*obj = *provider.SetDeliveryResult(obj, provider.DeliveryResult{Code: 500, Err: errors.New("failed"), Time: now})
+				obj.Status.LastCommit = "abc"
+			},
+			at:       now,
+			upToDate: true,
+		},
+		{
+			name: "spec changed",
+			change: func(obj *webhookv1.GitWatcher) {
+				obj.Spec.Branch = "main"
+			},
+			at: now,
+		},
+		{
+			name: "hook removed",
+			change: func(obj *webhookv1.GitWatcher) {
+				obj.Status.HookID = ""
+			},
+			at: now,
+		},
+		{
+			name: "rotation requested",
+			change: func(obj *webhookv1.GitWatcher) {
+				obj.Annotations = map[string]string{"rotate": "1"}
+			},
+			at: now,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newReconciled()
+			r.remember("default/watcher", reconciledObj, now)
+
+			obj := reconciledObj.DeepCopy()
+			test.change(obj)
+			if upToDate := r.upToDate("default/watcher", obj, test.at); upToDate != test.upToDate {
+				t.Errorf("expected up to date: %v, got %v", test.upToDate, upToDate)
+			}
+		})
+	}
+}
+
+func TestReconciledForget(t *testing.T) {
+	obj := &webhookv1.GitWatcher{}
+	r := newReconciled()
+	r.remember("default/watcher", obj, time.Now())
+	r.forget("default/watcher")
+	if r.upToDate("default/watcher", obj, time.Now()) {
+		t.Error("expected a forgotten GitWatcher to be reconciled again")
+	}
+}
@@ -0,0 +1,66 @@
+package crds
+
+import (
+	"reflect"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/wrangler/pkg/crd"
+	"github.com/sirupsen/logrus"
+	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	clientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// List returns the GitWatcher and GitCommit CRDs. Status is updated along with the rest of the
+// objects, so neither of them has a status subresource.
+func List() []apiext.CustomResourceDefinition {
+	gitWatcher := crd.FromGV(webhookv1.SchemeGroupVersion, "GitWatcher").ToCustomResourceDefinition()
+	gitWatcher.Spec.AdditionalPrinterColumns = []apiext.CustomResourceColumnDefinition{
+		{Name: "Provider", Type: "string", JSONPath: ".spec.provider"},
+		{Name: "Branch", Type: "string", JSONPath: ".spec.branch"},
+		{Name: "Last Commit", Type: "string", JSONPath: ".status.lastCommit"},
+		{Name: "Ready", Type: "string", JSONPath: `.status.conditions[?(@.type=="Ready")].status`},
+		{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+	}
+
+	gitCommit := crd.FromGV(webhookv1.SchemeGroupVersion, "GitCommit").ToCustomResourceDefinition()
+	return []apiext.CustomResourceDefinition{
+		gitWatcher,
+		gitCommit,
+	}
+}
+
+// Apply creates the CRDs that don't exist yet and updates the printer columns of existing ones
+func Apply(config *rest.Config) error {
+	client, err := clientset.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	crds := client.ApiextensionsV1beta1().CustomResourceDefinitions()
+
+	for _, def := range List() {
+		existing, err := crds.Get(def.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			logrus.Infof("Creating CRD %s", def.Name)
+			if _, err := crds.Create(&def); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if reflect.DeepEqual(existing.Spec.AdditionalPrinterColumns, def.Spec.AdditionalPrinterColumns) {
+			continue
+		}
+		logrus.Infof("Updating printer columns of CRD %s", def.Name)
+		existing = existing.DeepCopy()
+		existing.Spec.AdditionalPrinterColumns = def.Spec.AdditionalPrinterColumns
+		if _, err := crds.Update(existing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
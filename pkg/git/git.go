@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
 	"regexp"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -42,6 +46,38 @@ func CloneRepo(ctx context.Context, url string, commit string, auth *Auth) error
 	return nil
 }
 
+// ChangedFiles returns the files changed between the commits from and to, or by to alone when from is
+// empty. Only the two commits and their trees are fetched, into a temporary repository.
+func ChangedFiles(ctx context.Context, url, from, to string, auth *Auth) ([]string, error) {
+	url, env, close := auth.Populate(url)
+	defer close()
+
+	dir, err := ioutil.TempDir("", "gitwatcher-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := git(ctx, env, "-C", dir, "init", "-q"); err != nil {
+		return nil, err
+	}
+
+	// the parent of to is needed to tell what it changed on its own
+	depth, commits := "--depth=1", []string{to, from}
+	if from == "" {
+		depth, commits = "--depth=2", []string{to}
+	}
+	args := append([]string{"-C", dir, "-c", "protocol.version=2", "fetch", "-q", "--no-tags", "--filter=blob:none", depth, url}, commits...)
+	if _, err := git(ctx, env, args...); err != nil {
+		return nil, err
+	}
+
+	if from == "" {
+		return git(ctx, env, "-C", dir, "diff-tree", "--no-commit-id", "--name-only", "--no-renames", "-r", "--root", to)
+	}
+	return git(ctx, env, "-C", dir, "diff", "--name-only", "--no-renames", from, to)
+}
+
 // returns nil if tag qualifies, otherwise returns specific error
 func TagMatch(include, exclude, tagRef string) error {
 	if include != "" {
@@ -64,3 +100,94 @@ func TagMatch(include, exclude, tagRef string) error {
 	}
 	return nil
 }
+
+// BranchMatch returns nil if branch matches one of include, or include is empty, and none of
+// exclude. Patterns are globs, or regexps when enclosed in slashes.
+func BranchMatch(include, exclude []string, branch string) error {
+	if len(include) > 0 {
+		match, err := matchAny(include, branch)
+		if err != nil {
+			return err
+		}
+		if !match {
+			return fmt.Errorf("branch %s did not match include patterns", branch)
+		}
+	}
+	if len(exclude) > 0 {
+		match, err := matchAny(exclude, branch)
+		if err != nil {
+			return err
+		}
+		if match {
+			return fmt.Errorf("branch %s matched exclude patterns", branch)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, branch string) (bool, error) {
+	for _, pattern := range patterns {
+		var (
+			match bool
+			err   error
+		)
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			match, err = regexp.MatchString(pattern[1:len(pattern)-1], branch)
+		} else {
+			match, err = path.Match(pattern, branch)
+		}
+		if err != nil {
+			return false, fmt.Errorf("invalid branch pattern %s: %v", pattern, err)
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PathsMatch returns true if one of files matches one of include, or include is empty, and none of
+// exclude. Patterns are globs where ** matches any number of directories, and a pattern matching a
+// directory matches everything below it.
+func PathsMatch(include, exclude, files []string) bool {
+	for _, file := range files {
+		if (len(include) == 0 || matchAnyPath(include, file)) && !matchAnyPath(exclude, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyPath(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if globRegexp(pattern).MatchString(file) {
+			return true
+		}
+	}
+	return false
+}
+
+func globRegexp(pattern string) *regexp.Regexp {
+	pattern = strings.Trim(pattern, "/")
+
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("(?:/.*)?$")
+	return regexp.MustCompile(expr.String())
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBranchMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		branch  string
+		matches bool
+		invalid bool
+	}{
+		{
+			name:    "no patterns",
+			branch:  "main",
+			matches: true,
+		},
+		{
+			name:    "included glob",
+			include: []string{"main", "release/*"},
+			branch:  "release/v1.0",
+			matches: true,
+		},
+		{
+			name:    "glob doesn't cross slashes",
+			include: []string{"release/*"},
+			branch:  "release/v1/hotfix",
+		},
+		{
+			name:    "not included",
+			include: []string{"main"},
+			branch:  "feature",
+		},
+		{
+			name:    "excluded glob",
+			exclude: []string{"dependabot/*"},
+			branch:  "dependabot/go",
+		},
+		{
+			name:    "included and excluded",
+			include: []string{"release/*"},
+			exclude: []string{"release/old-*"},
+			branch:  "release/old-v0",
+		},
+		{
+			name:    "included regexp",
+			include: []string{"/^release-v[0-9]+$/"},
+			branch:  "release-v2",
+			matches: true,
+		},
+		{
+			name:    "excluded regexp",
+			exclude: []string{"/wip/"},
+			branch:  "feature-wip-login",
+		},
+		{
+			name:    "single slash is a glob",
+			include: []string{"/"},
+			branch:  "main",
+		},
+		{
+			name:    "invalid glob",
+			include: []string{"[main"},
+			branch:  "main",
+			invalid: true,
+		},
+		{
+			name:    "invalid regexp",
+			exclude: []string{"/(main/"},
+			branch:  "main",
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := BranchMatch(test.include, test.exclude, test.branch)
+			if test.matches && err != nil {
+				t.Errorf("expected %s to match, got %v", test.branch, err)
+			}
+			if !test.matches && err == nil {
+				t.Errorf("expected %s not to match", test.branch)
+			}
+			if test.invalid && err != nil && !strings.Contains(err.Error(), "invalid branch pattern") {
+				t.Errorf("expected an invalid pattern error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		matches bool
+	}{
+		{pattern: "main.go", file: "main.go", matches: true},
+		{pattern: "main.go", file: "cmd/main.go"},
+		{pattern: "main.go", file: "mainago"},
+		{pattern: "docs", file: "docs/README.md", matches: true},
+		{pattern: "docs/", file: "docs/README.md", matches: true},
+		{pattern: "/docs", file: "docs/README.md", matches: true},
+		{pattern: "docs", file: "docs-old/README.md"},
+		{pattern: "*.md", file: "README.md", matches: true},
+		{pattern: "*.md", file: "docs/README.md"},
+		{pattern: "docs/*.md", file: "docs/guide/README.md"},
+		{pattern: "**/*.md", file: "README.md", matches: true},
+		{pattern: "**/*.md", file: "docs/guide/README.md", matches: true},
+		{pattern: "pkg/**", file: "pkg/git/git.go", matches: true},
+		{pattern: "pkg/**/git.go", file: "pkg/git.go", matches: true},
+		{pattern: "pkg/**/git.go", file: "pkg/a/b/git.go", matches: true},
+		{pattern: "v?.go", file: "v1.go", matches: true},
+		{pattern: "v?.go", file: "v/.go"},
+		{pattern: "a+b(c).go", file: "a+b(c).go", matches: true},
+		{pattern: "docs/ü*", file: "docs/über.md", matches: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.file, func(t *testing.T) {
+			if matches := globRegexp(test.pattern).MatchString(test.file); matches != test.matches {
+				t.Errorf("expected %s to match %s: %v", test.pattern, test.file, test.matches)
+			}
+		})
+	}
+}
+
+func TestPathsMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		files   []string
+		matches bool
+	}{
+		{
+			name:    "no files",
+			include: []string{"pkg"},
+		},
+		{
+			name:    "included file",
+			include: []string{"pkg", "main.go"},
+			files:   []string{"docs/README.md", "main.go"},
+			matches: true,
+		},
+		{
+			name:    "nothing included",
+			include: []string{"pkg"},
+			files:   []string{"docs/README.md"},
+		},
+		{
+			name:    "only exclusions",
+			exclude: []string{"docs", "**/*.md"},
+			files:   []string{"docs/README.md", "main.go"},
+			matches: true,
+		},
+		{
+			name:    "everything excluded",
+			exclude: []string{"docs", "**/*.md"},
+			files:   []string{"docs/guide.txt", "README.md"},
+		},
+		{
+			name:    "included files excluded",
+			include: []string{"pkg"},
+			exclude: []string{"**/*_test.go"},
+			files:   []string{"pkg/git/git_test.go", "main.go"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := PathsMatch(test.include, test.exclude, test.files); matches != test.matches {
+				t.Errorf("expected %v to match: %v", test.files, test.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Status is what the health endpoints report about this replica
+type Status struct {
+	// LeaseName is the leader election lock the controllers run under
+	LeaseName string
+
+	leader    int32
+	synced    int32
+	providers int32
+}
+
+func NewStatus(leaseName string) *Status {
+	return &Status{
+		LeaseName: leaseName,
+	}
+}
+
+func (s *Status) SetLeader(leader bool) {
+	atomic.StoreInt32(&s.leader, toInt32(leader))
+}
+
+// SetSynced records that the informer caches the receiver reads from have synced
+func (s *Status) SetSynced() {
+	atomic.StoreInt32(&s.synced, 1)
+}
+
+// SetProviders records that the provider registry of the receiver has been built
+func (s *Status) SetProviders(count int) {
+	atomic.StoreInt32(&s.providers, int32(count))
+}
+
+func (s *Status) Leader() bool {
+	return atomic.LoadInt32(&s.leader) == 1
+}
+
+func (s *Status) Ready() bool {
+	return atomic.LoadInt32(&s.synced) == 1 && atomic.LoadInt32(&s.providers) > 0
+}
+
+// Healthz answers as long as the process serves requests
+func (s *Status) Healthz(rw http.ResponseWriter, req *http.Request) {
+	write(rw, http.StatusOK, map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// Readyz answers http.StatusServiceUnavailable until the caches synced and the providers are registered
+func (s *Status) Readyz(rw http.ResponseWriter, req *http.Request) {
+	code := http.StatusOK
+	if !s.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	write(rw, code, map[string]interface{}{
+		"cachesSynced": atomic.LoadInt32(&s.synced) == 1,
+		"providers":    atomic.LoadInt32(&s.providers),
+	})
+}
+
+// LeaderStatus reports whether this replica holds the lease, a replica that isn't leader still
+// serves webhooks but doesn't run the controllers
+func (s *Status) LeaderStatus(rw http.ResponseWriter, req *http.Request) {
+	identity, _ := os.Hostname()
+	write(rw, http.StatusOK, map[string]interface{}{
+		"lease":    s.LeaseName,
+		"identity": identity,
+		"leader":   s.Leader(),
+	})
+}
+
+func write(rw http.ResponseWriter, code int, obj interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		logrus.Errorf("Failed to write response, error: %v", err)
+	}
+}
+
+func toInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,74 +1,210 @@
 package hooks
 
 import (
+	"bytes"
+	"context"
+	"expvar"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	webhookv1controller "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/health"
+	"github.com/rancher/gitwatcher/pkg/metrics"
 	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/azuredevops"
+	"github.com/rancher/gitwatcher/pkg/provider/bitbucket"
+	"github.com/rancher/gitwatcher/pkg/provider/generic"
+	"github.com/rancher/gitwatcher/pkg/provider/gitea"
 	"github.com/rancher/gitwatcher/pkg/provider/github"
+	"github.com/rancher/gitwatcher/pkg/provider/gitlab"
 	"github.com/rancher/gitwatcher/pkg/types"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	"github.com/rancher/wrangler/pkg/kv"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/json"
 )
 
 type WebhookHandler struct {
 	gitWatcherCache webhookv1controller.GitWatcherCache
+	gitWatchers     webhookv1controller.GitWatcherController
 	gitCommit       webhookv1controller.GitCommitController
-	providers       []provider.Provider
+	providers       []hookProvider
+	journal         *Journal
+	queue           *deliveryQueue
+	results         *deliveryResults
 }
 
-func newHandler(rContext *types.Context) *WebhookHandler {
+// hookProvider is a provider with the name its deliveries are reported under
+type hookProvider struct {
+	name string
+	provider.Provider
+}
+
+// Options configures the optional parts of the webhook receiver
+type Options struct {
+	// Journal keeps validated deliveries for replay, nil disables it
+	Journal *Journal
+	// ReplayToken authenticates requests to the replay endpoint, empty disables it
+	ReplayToken string
+	// QueueSize is how many validated deliveries wait for QueueWorkers to handle them, zero
+	// handles deliveries within the request
+	QueueSize    int
+	QueueWorkers int
+	// Health is reported on /healthz, /readyz and /leader when set
+	Health *health.Status
+}
+
+func newHandler(rContext *types.Context, journal *Journal) *WebhookHandler {
 	secretCache := rContext.Core.Core().V1().Secret().Cache()
+	configMaps := rContext.Core.Core().V1().ConfigMap()
 	wh := &WebhookHandler{
 		gitWatcherCache: rContext.Webhook.Gitwatcher().V1().GitWatcher().Cache(),
+		gitWatchers:     rContext.Webhook.Gitwatcher().V1().GitWatcher(),
 		gitCommit:       rContext.Webhook.Gitwatcher().V1().GitCommit(),
+		journal:         journal,
 	}
-	wh.providers = append(wh.providers, github.NewGitHub(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache))
+	wh.results = newDeliveryResults(wh.gitWatchers)
+	// Gitea also sends GitHub's event header, so it has to see deliveries first
+	wh.addProvider("gitea", gitea.NewGitea(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
+	wh.addProvider("github", github.NewGitHub(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
+	wh.addProvider("gitlab", gitlab.NewGitLab(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
+	wh.addProvider("bitbucket", bitbucket.NewBitbucket(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
+	wh.addProvider("bitbucket-server", bitbucket.NewBitbucketServer(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
+	// Generic and Azure DevOps deliveries carry no event header and are recognized by their GitWatcher, so they go last
+	wh.addProvider("generic", generic.NewGeneric(wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
+	wh.addProvider("azuredevops", azuredevops.NewAzureDevOps(rContext.Apply, wh.gitCommit, rContext.Webhook.Gitwatcher().V1().GitWatcher(), secretCache, configMaps, rContext.Recorder))
 	return wh
 }
 
+func (h *WebhookHandler) addProvider(name string, p provider.Provider) {
+	h.providers = append(h.providers, hookProvider{
+		name:     name,
+		Provider: p,
+	})
+}
+
 func (h *WebhookHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	code, err := h.execute(req)
-	if err != nil {
-		e := map[string]interface{}{
-			"type":    "error",
-			"code":    code,
-			"message": err.Error(),
-		}
-		logrus.Debugf("executing webhook request got error: %v", err)
-		rw.WriteHeader(code)
-		responseBody, err := json.Marshal(e)
+	var body []byte
+	if h.journal != nil || h.queue != nil {
+		data, err := ioutil.ReadAll(req.Body)
 		if err != nil {
-			logrus.Errorf("Failed to unmarshall response, error: %v", err)
+			writeError(rw, http.StatusInternalServerError, err)
+			return
 		}
-		_, err = rw.Write(responseBody)
-		if err != nil {
-			logrus.Errorf("Failed to write response, error: %v", err)
+		body = data
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	ctx := provider.WithValidation(req.Context())
+	if h.queue != nil {
+		ctx = provider.WithValidateOnly(req.Context())
+	}
+	code, err := h.execute(req.WithContext(ctx))
+	if h.journal != nil && provider.Validated(ctx) {
+		if _, err := h.journal.Record(req, body, provider.CredentialHeaders(ctx)...); err != nil {
+			logrus.Errorf("Failed to journal webhook delivery, error: %v", err)
+		}
+	}
+	if err != nil {
+		writeError(rw, code, err)
+		return
+	}
+
+	if h.queue != nil && code == http.StatusAccepted {
+		if !h.queue.Add(req, body) {
+			writeError(rw, http.StatusServiceUnavailable, fmt.Errorf("webhook queue is full"))
+			return
 		}
+		rw.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func writeError(rw http.ResponseWriter, code int, err error) {
+	e := map[string]interface{}{
+		"type":    "error",
+		"code":    code,
+		"message": err.Error(),
+	}
+	logrus.Debugf("executing webhook request got error: %v", err)
+	rw.WriteHeader(code)
+	responseBody, err := json.Marshal(e)
+	if err != nil {
+		logrus.Errorf("Failed to unmarshall response, error: %v", err)
+	}
+	_, err = rw.Write(responseBody)
+	if err != nil {
+		logrus.Errorf("Failed to write response, error: %v", err)
 	}
 }
 
 func (h *WebhookHandler) execute(req *http.Request) (int, error) {
-	for _, provider := range h.providers {
-		code, err := provider.HandleHook(req.Context(), req)
-		if err != nil {
-			return code, err
+	ctx := req.Context()
+	for _, p := range h.providers {
+		code, err := p.HandleHook(ctx, req)
+		if code == 0 && err == nil {
+			// not a delivery this provider understands
+			continue
 		}
-		return code, nil
+		h.observe(req, p.name, code, err)
+		return code, err
 	}
+	h.observe(req, "unknown", http.StatusNotFound, nil)
 	return http.StatusNotFound, fmt.Errorf("unknown provider")
 }
 
-func HandleHooks(ctx *types.Context) http.Handler {
+// observe records the outcome of a delivery in metrics and queues it for the status of its
+// GitWatcher, a delivery only validated for the queue is recorded once the queue handled it
+func (h *WebhookHandler) observe(req *http.Request, providerName string, code int, deliveryErr error) {
+	ctx := req.Context()
+	if provider.ValidationFailed(ctx) {
+		metrics.WebhookValidationFailures.WithLabelValues(providerName).Inc()
+	}
+	if provider.ValidateOnly(ctx) && code == http.StatusAccepted {
+		return
+	}
+	metrics.WebhookDeliveries.WithLabelValues(providerName, provider.EventType(ctx), strconv.Itoa(code)).Inc()
+
+	ns, name := kv.Split(req.URL.Query().Get(utils.GitWebHookParam), ":")
+	if name == "" {
+		return
+	}
+	h.results.Add(ns, name, provider.NewDeliveryResult(ctx, code, deliveryErr, time.Now()))
+}
+
+func HandleHooks(ctx context.Context, rContext *types.Context, opts Options) http.Handler {
 	root := mux.NewRouter()
-	hooksHandler := newHandler(ctx)
+	hooksHandler := newHandler(rContext, opts.Journal)
+	go hooksHandler.results.run(ctx)
+	if opts.QueueSize > 0 {
+		hooksHandler.queue = newDeliveryQueue(ctx, opts.QueueSize, opts.QueueWorkers, hooksHandler.execute)
+		expvar.Publish("webhookQueue", expvar.Func(func() interface{} {
+			return hooksHandler.queue.Stats()
+		}))
+		root.Handle("/debug/vars", expvar.Handler())
+	}
 	logsHander := logsHandler{
-		core: ctx.K8s.CoreV1(),
+		core: rContext.K8s.CoreV1(),
 	}
 	root.UseEncodedPath()
 	root.PathPrefix("/hooks").Handler(hooksHandler)
 	root.PathPrefix("/logs").Handler(logsHander)
+	root.Handle("/metrics", metrics.Handler())
+	if opts.Health != nil {
+		opts.Health.SetProviders(len(hooksHandler.providers))
+		root.HandleFunc("/healthz", opts.Health.Healthz)
+		root.HandleFunc("/readyz", opts.Health.Readyz)
+		root.HandleFunc("/leader", opts.Health.LeaderStatus)
+	}
+	if opts.Journal != nil && opts.ReplayToken != "" {
+		root.PathPrefix("/replay").Handler(&replayHandler{
+			hooks:   hooksHandler,
+			journal: opts.Journal,
+			token:   opts.ReplayToken,
+		})
+	}
 	return root
 }
@@ -0,0 +1,179 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	journalSuffix = ".json"
+)
+
+// credentialHeaders are never journaled, replays skip validation so they don't need them
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// JournalEntry is a validated delivery as it was received
+type JournalEntry struct {
+	ID         string      `json:"id"`
+	Received   time.Time   `json:"received"`
+	Method     string      `json:"method"`
+	RequestURI string      `json:"requestURI"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+// Request rebuilds the delivery so it can be handled again
+func (e *JournalEntry) Request() (*http.Request, error) {
+	req, err := http.NewRequest(e.Method, e.RequestURI, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = e.Header
+	return req, nil
+}
+
+// Journal keeps the last size validated deliveries as files in dir, so they can be replayed
+type Journal struct {
+	dir  string
+	size int
+	lock sync.Mutex
+}
+
+func NewJournal(dir string, size int) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Journal{
+		dir:  dir,
+		size: size,
+	}, nil
+}
+
+// Record journals the delivery req, leaving out its credentials and the headers named by redact
+func (j *Journal) Record(req *http.Request, body []byte, redact ...string) (*JournalEntry, error) {
+	header := http.Header{}
+	for name, values := range req.Header {
+		header[name] = values
+	}
+	for _, name := range credentialHeaders {
+		header.Del(name)
+	}
+	for _, name := range redact {
+		header.Del(name)
+	}
+
+	entry := &JournalEntry{
+		ID:         uuid.New().String(),
+		Received:   time.Now().UTC(),
+		Method:     req.Method,
+		RequestURI: req.URL.RequestURI(),
+		Header:     header,
+		Body:       body,
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	// the timestamp prefix keeps file names in the order deliveries were received
+	fileName := fmt.Sprintf("%d-%s%s", entry.Received.UnixNano(), entry.ID, journalSuffix)
+	if err := ioutil.WriteFile(filepath.Join(j.dir, fileName), data, 0600); err != nil {
+		return nil, err
+	}
+	return entry, j.prune()
+}
+
+// List returns the journaled deliveries, oldest first
+func (j *Journal) List() ([]*JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	files, err := j.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*JournalEntry
+	for _, file := range files {
+		entry, err := j.read(file)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (j *Journal) Get(id string) (*JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	files, err := j.files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "-"+id+journalSuffix) {
+			return j.read(file)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (j *Journal) read(file string) (*JournalEntry, error) {
+	data, err := ioutil.ReadFile(filepath.Join(j.dir, file))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &JournalEntry{}
+	return entry, json.Unmarshal(data, entry)
+}
+
+func (j *Journal) files() ([]string, error) {
+	infos, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), journalSuffix) {
+			files = append(files, info.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// prune drops the oldest deliveries beyond the journal size
+func (j *Journal) prune() error {
+	files, err := j.files()
+	if err != nil {
+		return err
+	}
+
+	for len(files) > j.size {
+		if err := os.Remove(filepath.Join(j.dir, files[0])); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJournalRecordLeavesOutCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := NewJournal(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/?gitwebhookId=default:watcher", strings.NewReader("{}"))
+	req.SetBasicAuth("gitwatcher", "hook-token")
+	req.Header.Set("X-Gitlab-Token", "hook-token")
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	if _, err := journal.Record(req, []byte("{}"), "X-Gitlab-Token"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if req.Header.Get("Authorization") == "" {
+		t.Error("expected the delivery itself to keep its headers")
+	}
+
+	entries, err := journal.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one journaled delivery, got %d: %v", len(entries), err)
+	}
+	header := entries[0].Header
+	for _, name := range []string{"Authorization", "X-Gitlab-Token"} {
+		if header.Get(name) != "" {
+			t.Errorf("expected %s to be left out of the journal", name)
+		}
+	}
+	if header.Get("X-Gitlab-Event") != "Push Hook" {
+		t.Errorf("expected the event header to be journaled, got %v", header)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(dir + "/" + file.Name())
+		if strings.Contains(string(data), "hook-token") {
+			t.Errorf("expected %s not to contain the token", file.Name())
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package hooks
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queueMaxRetries   = 5
+	queueRetryBackoff = time.Second
+)
+
+// QueueStats is a snapshot of the delivery queue
+type QueueStats struct {
+	Depth    int   `json:"depth"`
+	Capacity int   `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+	Retried  int64 `json:"retried"`
+	Failed   int64 `json:"failed"`
+}
+
+type queuedDelivery struct {
+	entry   *JournalEntry
+	attempt int
+}
+
+// deliveryQueue handles validated deliveries on worker goroutines, so the receiver can answer
+// well within the delivery timeout of the sender
+type deliveryQueue struct {
+	ctx     context.Context
+	items   chan *queuedDelivery
+	handle  func(req *http.Request) (int, error)
+	dropped int64
+	retried int64
+	failed  int64
+}
+
+func newDeliveryQueue(ctx context.Context, size, workers int, handle func(req *http.Request) (int, error)) *deliveryQueue {
+	q := &deliveryQueue{
+		ctx:    ctx,
+		items:  make(chan *queuedDelivery, size),
+		handle: handle,
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	return q
+}
+
+// Add queues a delivery, it returns false when the queue is full and the delivery was dropped
+func (q *deliveryQueue) Add(req *http.Request, body []byte) bool {
+	return q.add(&queuedDelivery{
+		entry: &JournalEntry{
+			Received:   time.Now().UTC(),
+			Method:     req.Method,
+			RequestURI: req.URL.RequestURI(),
+			Header:     req.Header,
+			Body:       body,
+		},
+	})
+}
+
+func (q *deliveryQueue) add(item *queuedDelivery) bool {
+	select {
+	case q.items <- item:
+		return true
+	default:
+		atomic.AddInt64(&q.dropped, 1)
+		return false
+	}
+}
+
+func (q *deliveryQueue) Stats() QueueStats {
+	return QueueStats{
+		Depth:    len(q.items),
+		Capacity: cap(q.items),
+		Dropped:  atomic.LoadInt64(&q.dropped),
+		Retried:  atomic.LoadInt64(&q.retried),
+		Failed:   atomic.LoadInt64(&q.failed),
+	}
+}
+
+func (q *deliveryQueue) run() {
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case item := <-q.items:
+			q.process(item)
+		}
+	}
+}
+
+func (q *deliveryQueue) process(item *queuedDelivery) {
+	req, err := item.entry.Request()
+	if err != nil {
+		logrus.Errorf("Failed to rebuild queued webhook delivery, error: %v", err)
+		return
+	}
+
+	code, err := q.handle(req.WithContext(provider.WithoutValidation(q.ctx)))
+	if err == nil {
+		return
+	}
+	if code < http.StatusInternalServerError {
+		logrus.Debugf("executing queued webhook request got error: %v", err)
+		return
+	}
+	if item.attempt >= queueMaxRetries {
+		atomic.AddInt64(&q.failed, 1)
+		logrus.Errorf("Failed to handle webhook delivery %s after %d retries, error: %v", item.entry.RequestURI, item.attempt, err)
+		return
+	}
+
+	// retry with exponential backoff without holding up a worker
+	item.attempt++
+	atomic.AddInt64(&q.retried, 1)
+	logrus.Infof("retrying webhook delivery %s in %s, error: %v", item.entry.RequestURI, queueRetryBackoff<<uint(item.attempt-1), err)
+	time.AfterFunc(queueRetryBackoff<<uint(item.attempt-1), func() {
+		if !q.add(item) {
+			logrus.Errorf("Dropped webhook delivery %s, the queue is full", item.entry.RequestURI)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ReplayClient lists and replays the journaled deliveries of a running receiver
+type ReplayClient struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func (c *ReplayClient) List() ([]Delivery, error) {
+	var deliveries []Delivery
+	return deliveries, c.do(http.MethodGet, "/replay", &deliveries)
+}
+
+func (c *ReplayClient) Replay(id string) (*ReplayResult, error) {
+	result := &ReplayResult{}
+	return result, c.do(http.MethodPost, "/replay/"+url.PathEscape(id), result)
+}
+
+func (c *ReplayClient) do(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed, code: %v, error: %s", method, path, resp.StatusCode, data)
+	}
+	return json.Unmarshal(data, out)
+}
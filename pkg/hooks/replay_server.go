@@ -0,0 +1,108 @@
+package hooks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/sirupsen/logrus"
+)
+
+// Delivery summarizes a journaled delivery for the replay endpoint
+type Delivery struct {
+	ID         string    `json:"id"`
+	Received   time.Time `json:"received"`
+	RequestURI string    `json:"requestURI"`
+}
+
+// ReplayResult is what handling a replayed delivery returned
+type ReplayResult struct {
+	ID      string `json:"id"`
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// replayHandler lists journaled deliveries on GET /replay and handles one of them again on
+// POST /replay/<id>, without validating its signature a second time
+type replayHandler struct {
+	hooks   *WebhookHandler
+	journal *Journal
+	token   string
+}
+
+func (h *replayHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		writeError(rw, http.StatusUnauthorized, fmt.Errorf("invalid replay token"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && req.Method == http.MethodGet:
+		h.list(rw)
+	case len(parts) == 2 && req.Method == http.MethodPost:
+		h.replay(rw, req, parts[1])
+	default:
+		writeError(rw, http.StatusNotFound, fmt.Errorf("invalid request path"))
+	}
+}
+
+func (h *replayHandler) list(rw http.ResponseWriter) {
+	entries, err := h.journal.List()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	deliveries := []Delivery{}
+	for _, entry := range entries {
+		deliveries = append(deliveries, Delivery{
+			ID:         entry.ID,
+			Received:   entry.Received,
+			RequestURI: entry.RequestURI,
+		})
+	}
+	writeJSON(rw, http.StatusOK, deliveries)
+}
+
+func (h *replayHandler) replay(rw http.ResponseWriter, req *http.Request, id string) {
+	entry, err := h.journal.Get(id)
+	if os.IsNotExist(err) {
+		writeError(rw, http.StatusNotFound, fmt.Errorf("delivery %s not found", id))
+		return
+	} else if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	delivery, err := entry.Request()
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	logrus.Infof("replaying webhook delivery %s received %s", entry.ID, entry.Received)
+	code, err := h.hooks.execute(delivery.WithContext(provider.WithoutValidation(req.Context())))
+	result := ReplayResult{
+		ID:   entry.ID,
+		Code: code,
+	}
+	if err != nil {
+		result.Message = err.Error()
+	}
+	writeJSON(rw, http.StatusOK, result)
+}
+
+func writeJSON(rw http.ResponseWriter, code int, obj interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(obj); err != nil {
+		logrus.Errorf("Failed to write response, error: %v", err)
+	}
+}
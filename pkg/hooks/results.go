@@ -0,0 +1,74 @@
+package hooks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	webhookv1controller "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/wrangler/pkg/kv"
+	"github.com/rancher/wrangler/pkg/ticker"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// resultsInterval is how often the outcome of deliveries is written to the status of their GitWatcher
+const resultsInterval = 5 * time.Second
+
+// deliveryResults writes the outcome of deliveries to the status of their GitWatcher in the
+// background, so handling a delivery doesn't wait on the API server and a burst of deliveries for
+// one GitWatcher updates it once
+type deliveryResults struct {
+	gitWatchers webhookv1controller.GitWatcherClient
+	lock        sync.Mutex
+	pending     map[string][]provider.DeliveryResult
+}
+
+func newDeliveryResults(gitWatchers webhookv1controller.GitWatcherClient) *deliveryResults {
+	return &deliveryResults{
+		gitWatchers: gitWatchers,
+		pending:     map[string][]provider.DeliveryResult{},
+	}
+}
+
+// Add records the outcome of a delivery for the GitWatcher namespace/name
+func (d *deliveryResults) Add(namespace, name string, result provider.DeliveryResult) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	key := namespace + ":" + name
+	d.pending[key] = append(d.pending[key], result)
+}
+
+func (d *deliveryResults) run(ctx context.Context) {
+	for range ticker.Context(ctx, resultsInterval) {
+		d.flush()
+	}
+}
+
+func (d *deliveryResults) flush() {
+	d.lock.Lock()
+	pending := d.pending
+	d.pending = map[string][]provider.DeliveryResult{}
+	d.lock.Unlock()
+
+	for key, results := range pending {
+		ns, name := kv.Split(key, ":")
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			gitWatcher, err := d.gitWatchers.Get(ns, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			for _, result := range results {
+				gitWatcher = provider.SetDeliveryResult(gitWatcher, result)
+			}
+			_, err = d.gitWatchers.Update(gitWatcher)
+			return err
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			logrus.Errorf("Failed to record webhook deliveries for gitwatcher %s/%s, error: %v", ns, name, err)
+		}
+	}
+}
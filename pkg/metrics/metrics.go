@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gitwatcher"
+
+var (
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook deliveries handled, by provider, event type and response code",
+	}, []string{"provider", "event", "code"})
+
+	WebhookValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_validation_failures_total",
+		Help:      "Webhook deliveries rejected because their signature or token did not validate, by provider",
+	}, []string{"provider"})
+
+	GitCommitsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gitcommits_created_total",
+		Help:      "GitCommits created, by the webhook event type or poll they were created from",
+	}, []string{"source"})
+
+	PollDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "poll_duration_seconds",
+		Help:      "Time taken to poll the watched branch of a GitWatcher",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace", "gitwatcher"})
+
+	PollFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "poll_failures_total",
+		Help:      "git ls-remote calls that failed while polling a GitWatcher",
+	}, []string{"namespace", "gitwatcher"})
+
+	GitHubAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "github_api_request_duration_seconds",
+		Help:      "Latency of GitHub API calls, by host, method and response code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "method", "code"})
+
+	GitHubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_api_rate_limit_remaining",
+		Help:      "GitHub API requests left in the current rate limit window, as last reported by host",
+	}, []string{"host"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		WebhookDeliveries,
+		WebhookValidationFailures,
+		GitCommitsCreated,
+		PollDuration,
+		PollFailures,
+		GitHubAPIDuration,
+		GitHubRateLimitRemaining,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObservePoll records how long polling the GitWatcher namespace/name took and whether it failed
+func ObservePoll(namespace, name string, start time.Time, err error) {
+	PollDuration.WithLabelValues(namespace, name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		PollFailures.WithLabelValues(namespace, name).Inc()
+	}
+}
+
+// GitHubTransport wraps rt so every GitHub API call it makes records its latency and the rate
+// limit left
+func GitHubTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return githubTransport{next: rt}
+}
+
+type githubTransport struct {
+	next http.RoundTripper
+}
+
+func (t githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+			GitHubRateLimitRemaining.WithLabelValues(req.URL.Host).Set(float64(remaining))
+		}
+	}
+	GitHubAPIDuration.WithLabelValues(req.URL.Host, req.Method, code).Observe(time.Since(start).Seconds())
+	return resp, err
+}
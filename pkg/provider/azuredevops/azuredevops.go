@@ -0,0 +1,454 @@
+package azuredevops
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/polling"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
+	"github.com/rancher/wrangler/pkg/kv"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// HookUsername is the basic auth user service hooks authenticate as, the password is the GitWatcher token
+	HookUsername = "gitwatcher"
+	hookIDSep    = ","
+	zeroObjectID = "0000000000000000000000000000000000000000"
+)
+
+const (
+	statusOpened = "opened"
+	statusClosed = "closed"
+	statusSynced = "synchronize"
+)
+
+type AzureDevOps struct {
+	gitWatchers v1.GitWatcherController
+	gitCommits  v1.GitCommitController
+	secretCache corev1controller.SecretCache
+	configMaps  corev1controller.ConfigMapController
+	recorder    record.EventRecorder
+	httpClient  *http.Client
+	apply       apply.Apply
+}
+
+func NewAzureDevOps(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *AzureDevOps {
+	return &AzureDevOps{
+		secretCache: secretCache,
+		configMaps:  configMaps,
+		recorder:    recorder,
+		gitCommits:  gitCommits,
+		gitWatchers: gitWatchers,
+		apply:       apply.WithStrictCaching(),
+		httpClient:  http.DefaultClient,
+	}
+}
+
+func (w *AzureDevOps) Supports(obj *webhookv1.GitWatcher) bool {
+	if obj.Spec.GithubWebhookToken == "" {
+		return false
+	}
+	_, err := w.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if errors2.IsNotFound(err) {
+		return false
+	}
+
+	return isAzureDevOps(obj)
+}
+
+func isAzureDevOps(obj *webhookv1.GitWatcher) bool {
+	if strings.EqualFold(obj.Spec.Provider, "azure-devops") {
+		return true
+	}
+
+	u, err := url.Parse(obj.Spec.RepositoryURL)
+	if err != nil {
+		return false
+	}
+	return u.Host == "dev.azure.com" || strings.HasSuffix(u.Host, ".visualstudio.com")
+}
+
+func (w *AzureDevOps) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.HookID != "" {
+		return obj, nil
+	}
+
+	orgURL, project, repo, err := ParseRepositoryURL(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	client, err := w.getClient(obj, orgURL)
+	if err != nil {
+		return obj, err
+	}
+
+	repository, err := client.GetRepository(ctx, project, repo)
+	if err != nil {
+		return obj, fmt.Errorf("failed to get repository %s/%s, error: %v", project, repo, err)
+	}
+
+	obj, err = w.createSubscriptions(ctx, obj, client, repository)
+	if err != nil {
+		return obj, err
+	}
+
+	return w.getFirstCommit(ctx, obj, client, repository)
+}
+
+func (w *AzureDevOps) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	if obj.Status.HookID == "" {
+		return nil
+	}
+
+	orgURL, _, _, err := ParseRepositoryURL(obj.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	client, err := w.getClient(obj, orgURL)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range strings.Split(obj.Status.HookID, hookIDSep) {
+		if err := client.DeleteSubscription(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete subscription %s, error: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (w *AzureDevOps) getFirstCommit(ctx context.Context, obj *webhookv1.GitWatcher, client *Client, repository *Repository) (*webhookv1.GitWatcher, error) {
+	if obj.Status.FirstCommit != "" || obj.Spec.Branch == "" {
+		return obj, nil
+	}
+
+	ref, err := client.GetBranch(ctx, repository, obj.Spec.Branch)
+	if err != nil {
+		return obj, fmt.Errorf("failed to get ref for %s, error: %v", repository.Name, err)
+	}
+
+	err = polling.ApplyCommit(obj, ref.ObjectID, w.apply)
+	obj = obj.DeepCopy()
+	obj.Status.FirstCommit = ref.ObjectID
+	return obj, err
+}
+
+// createSubscriptions registers a service hook subscription per event type, Status.HookID holds
+// the comma separated subscription IDs. When one fails the ones created before it are deleted, so
+// retries don't leave duplicates behind.
+func (w *AzureDevOps) createSubscriptions(ctx context.Context, obj *webhookv1.GitWatcher, client *Client, repository *Repository) (*webhookv1.GitWatcher, error) {
+	obj = obj.DeepCopy()
+	obj.Status.Token = uuid.New().String()
+
+	var ids []string
+	for _, eventType := range getEvents(obj) {
+		subscription, err := client.CreateSubscription(ctx, &Subscription{
+			PublisherID:      "tfs",
+			EventType:        eventType,
+			ResourceVersion:  "1.0",
+			ConsumerID:       "webHooks",
+			ConsumerActionID: "httpRequest",
+			PublisherInputs: map[string]string{
+				"projectId":  repository.Project.ID,
+				"repository": repository.ID,
+			},
+			ConsumerInputs: map[string]string{
+				"url":                   provider.HookEndpoint(obj),
+				"basicAuthUsername":     HookUsername,
+				"basicAuthPassword":     obj.Status.Token,
+				"resourceDetailsToSend": "all",
+			},
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to create %s subscription for %s, error: %v", eventType, repository.Name, err)
+			return obj, deleteSubscriptions(ctx, client, ids, err)
+		}
+		ids = append(ids, subscription.ID)
+	}
+
+	obj.Status.HookID = strings.Join(ids, hookIDSep)
+	return obj, nil
+}
+
+// deleteSubscriptions removes the subscriptions ids after creating them failed with err. Those it
+// can't remove are recorded in the returned error as they are left behind.
+func deleteSubscriptions(ctx context.Context, client *Client, ids []string, err error) error {
+	var leaked []string
+	for _, id := range ids {
+		if deleteErr := client.DeleteSubscription(ctx, id); deleteErr != nil {
+			leaked = append(leaked, id)
+		}
+	}
+	if len(leaked) > 0 {
+		return fmt.Errorf("%v, failed to delete subscriptions %s", err, strings.Join(leaked, hookIDSep))
+	}
+	return err
+}
+
+func getEvents(obj *webhookv1.GitWatcher) []string {
+	var events []string
+	if obj.Spec.Push || obj.Spec.Tag {
+		events = append(events, eventPush)
+	}
+
+	if obj.Spec.PR {
+		events = append(events, eventPullRequestCreated, eventPullRequestUpdated, eventPullRequestMerged)
+	}
+
+	if len(events) == 0 {
+		// like GitHub, a hook without events defaults to pushes
+		events = append(events, eventPush)
+	}
+	return events
+}
+
+func (w *AzureDevOps) getClient(obj *webhookv1.GitWatcher, orgURL string) (*Client, error) {
+	if obj.Spec.GithubWebhookToken == "" {
+		return nil, errors.New("azure devops webhook token not found")
+	}
+	secret, err := w.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(w.httpClient, orgURL, string(secret.Data["accessToken"])), nil
+}
+
+// HandleHook has no event header to recognize service hook deliveries by, so it only claims
+// deliveries for GitWatchers pointing at Azure DevOps
+func (w *AzureDevOps) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	receiverID := req.URL.Query().Get(utils.GitWebHookParam)
+	if receiverID == "" {
+		return 0, nil
+	}
+
+	ns, name := kv.Split(receiverID, ":")
+	gitwatcher, err := w.gitWatchers.Get(ns, name, metav1.GetOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !isAzureDevOps(gitwatcher) {
+		return 0, nil
+	}
+
+	if !gitwatcher.Spec.Enabled {
+		return http.StatusUnprocessableEntity, errors.New("webhook receiver is disabled")
+	}
+
+	gitwatcher, err = provider.LoadTokens(w.secretCache, gitwatcher)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	err = provider.Validate(ctx, func() error {
+		username, password, ok := req.BasicAuth()
+		if !ok || gitwatcher.Status.Token == "" || username != HookUsername ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(gitwatcher.Status.Token)) != 1 {
+			return errors.New("invalid service hook credentials")
+		}
+		return nil
+	})
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if provider.ValidateOnly(ctx) {
+		return http.StatusAccepted, nil
+	}
+
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	parsed := &event{}
+	if err := json.Unmarshal(payload, parsed); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	ctx = provider.WithDelivery(ctx, provider.Delivery{
+		EventType: parsed.EventType,
+		ID:        parsed.ID,
+		Payload:   payload,
+	})
+	return w.handleEvent(ctx, parsed, gitwatcher)
+}
+
+func (w *AzureDevOps) handleEvent(ctx context.Context, event *event, receiver *webhookv1.GitWatcher) (int, error) {
+	execution := provider.NewGitCommit(receiver)
+	switch event.EventType {
+	case eventPush:
+		parsed := &push{}
+		if err := json.Unmarshal(event.Resource, parsed); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if len(parsed.RefUpdates) == 0 {
+			return http.StatusUnprocessableEntity, errors.New("push event has no ref updates")
+		}
+		update := parsed.RefUpdates[0]
+		if update.NewObjectID == zeroObjectID {
+			return http.StatusUnprocessableEntity, errors.New("push event only handles created or updated refs")
+		}
+
+		switch {
+		case strings.HasPrefix(update.Name, "refs/heads/"):
+			if !receiver.Spec.Push {
+				return http.StatusUnprocessableEntity, fmt.Errorf("push watching is not currently turned on")
+			}
+			execution.Spec.Branch = strings.TrimPrefix(update.Name, "refs/heads/")
+			if err := git.BranchMatch(receiver.Spec.BranchInclude, receiver.Spec.BranchExclude, execution.Spec.Branch); err != nil {
+				return http.StatusUnprocessableEntity, err
+			}
+		case strings.HasPrefix(update.Name, "refs/tags/"):
+			if !receiver.Spec.Tag {
+				return http.StatusUnprocessableEntity, fmt.Errorf("tag watching is not currently turned on")
+			}
+			execution.Spec.Tag = strings.TrimPrefix(update.Name, "refs/tags/")
+			err := git.TagMatch(receiver.Spec.TagIncludeRegexp, receiver.Spec.TagExcludeRegexp, execution.Spec.Tag)
+			if err != nil {
+				return http.StatusUnprocessableEntity, err
+			}
+		default:
+			return http.StatusUnprocessableEntity, fmt.Errorf("push event for ref %s is not supported", update.Name)
+		}
+
+		setAuthor(execution, parsed.PushedBy)
+
+		if execution.Spec.Branch != "" && provider.FiltersPaths(receiver) {
+			files, err := w.pushedFiles(ctx, receiver, update)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			if err := provider.MatchPaths(receiver, execution, files); err != nil {
+				return http.StatusUnprocessableEntity, err
+			}
+		}
+
+		execution.Spec.Commit = update.NewObjectID
+		for _, commit := range parsed.Commits {
+			if commit.CommitID == update.NewObjectID {
+				execution.Spec.Message = commit.Comment
+				execution.Spec.SourceLink = fmt.Sprintf("%s/commit/%s", parsed.Repository.WebURL, commit.CommitID)
+			}
+		}
+
+	case eventPullRequestCreated, eventPullRequestUpdated, eventPullRequestMerged:
+		if !receiver.Spec.PR {
+			return http.StatusUnprocessableEntity, fmt.Errorf("pull request is not enabled")
+		}
+		parsed := &pullRequest{}
+		if err := json.Unmarshal(event.Resource, parsed); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		action, merged, ok := pullRequestAction(event.EventType, parsed)
+		if !ok {
+			return http.StatusUnprocessableEntity, fmt.Errorf("action %s with status %s ommitted", event.EventType, parsed.Status)
+		}
+		execution.Spec.Action = action
+		execution.Spec.Merged = merged
+		setAuthor(execution, parsed.CreatedBy)
+		execution.Spec.PR = strconv.Itoa(parsed.PullRequestID)
+		execution.Spec.Title = parsed.Title
+		execution.Spec.Message = parsed.Description
+		execution.Spec.Commit = parsed.LastMergeSourceCommit.CommitID
+		if parsed.Repository.WebURL != "" {
+			execution.Spec.RepositoryURL = parsed.Repository.WebURL
+			execution.Spec.SourceLink = fmt.Sprintf("%s/pullrequest/%d", parsed.Repository.WebURL, parsed.PullRequestID)
+		}
+
+		if action == statusClosed {
+			execution.Spec.Closed = true
+		}
+
+	default:
+		return http.StatusUnprocessableEntity, fmt.Errorf("event %s is not supported", event.EventType)
+	}
+
+	if err := provider.CreateGitCommit(ctx, w.gitCommits, w.configMaps, w.recorder, receiver, execution); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// pushedFiles returns the files changed by a push, push events don't list them so they are compared
+// through the API. A push creating a branch is compared against the parent of its head commit.
+func (w *AzureDevOps) pushedFiles(ctx context.Context, receiver *webhookv1.GitWatcher, update refUpdate) ([]string, error) {
+	orgURL, project, repo, err := ParseRepositoryURL(receiver.Spec.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := w.getClient(receiver, orgURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	if update.OldObjectID == "" || update.OldObjectID == zeroObjectID {
+		changes, err = client.GetCommitChanges(ctx, project, repo, update.NewObjectID)
+	} else {
+		changes, err = client.CompareCommits(ctx, project, repo, update.OldObjectID, update.NewObjectID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes of %s...%s of %s, error: %v", update.OldObjectID, update.NewObjectID, repo, err)
+	}
+
+	var files []string
+	for _, change := range changes {
+		if change.Item.IsFolder {
+			continue
+		}
+		files = append(files, strings.TrimPrefix(change.Item.Path, "/"))
+		if change.SourceServerItem != "" {
+			files = append(files, strings.TrimPrefix(change.SourceServerItem, "/"))
+		}
+	}
+	return files, nil
+}
+
+// pullRequestAction maps pull request events onto the actions GitHub reports. Completing a pull
+// request sends both an updated and a merged event, only the merged one is reported.
+func pullRequestAction(eventType string, pr *pullRequest) (string, bool, bool) {
+	switch eventType {
+	case eventPullRequestCreated:
+		return statusOpened, false, true
+	case eventPullRequestMerged:
+		if pr.Status == "completed" && pr.MergeStatus == "succeeded" {
+			return statusClosed, true, true
+		}
+	case eventPullRequestUpdated:
+		switch pr.Status {
+		case "abandoned":
+			return statusClosed, false, true
+		case "active":
+			return statusSynced, false, true
+		}
+	}
+	return "", false, false
+}
+
+func setAuthor(execution *webhookv1.GitCommit, user identity) {
+	execution.Spec.Author = user.DisplayName
+	execution.Spec.AuthorEmail = user.UniqueName
+	execution.Spec.AuthorAvatar = user.ImageURL
+}
@@ -0,0 +1,128 @@
+package azuredevops
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"testing"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type fakeSecrets struct {
+	corev1controller.SecretCache
+}
+
+func (f *fakeSecrets) Get(namespace, name string) (*corev1.Secret, error) {
+	return &corev1.Secret{
+		Data: map[string][]byte{
+			"accessToken": []byte("access-token"),
+		},
+	}, nil
+}
+
+func TestPushedFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		oldObjectID string
+		path        string
+	}{
+		{
+			name:        "push to an existing branch",
+			oldObjectID: "abc",
+			path:        "/org/project/_apis/git/repositories/repo/diffs/commits",
+		},
+		{
+			name:        "push creating a branch",
+			oldObjectID: zeroObjectID,
+			path:        "/org/project/_apis/git/repositories/repo/commits/def/changes",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if _, password, _ := r.BasicAuth(); password != "access-token" || query.Get("api-version") != apiVersion || r.URL.Path != test.path {
+					http.NotFound(w, r)
+					return
+				}
+				if query.Get("baseVersion") != "" && (query.Get("baseVersion") != "abc" || query.Get("targetVersion") != "def") {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, `{"allChangesIncluded": true, "changes": [
+					{"item": {"path": "/services/api", "isFolder": true}},
+					{"item": {"path": "/services/api/main.go"}},
+					{"item": {"path": "/services/api/new.go"}, "sourceServerItem": "/services/api/old.go"}
+				]}`)
+			}))
+			defer server.Close()
+
+			w := &AzureDevOps{
+				secretCache: &fakeSecrets{},
+				httpClient:  server.Client(),
+			}
+			receiver := &webhookv1.GitWatcher{
+				Spec: webhookv1.GitWatcherSpec{
+					RepositoryURL:      server.URL + "/org/project/_git/repo",
+					GithubWebhookToken: "azure-credentials",
+				},
+			}
+			files, err := w.pushedFiles(context.Background(), receiver, refUpdate{
+				Name:        "refs/heads/main",
+				OldObjectID: test.oldObjectID,
+				NewObjectID: "def",
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := []string{"services/api/main.go", "services/api/new.go", "services/api/old.go"}
+			if !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected files %v, got %v", expected, files)
+			}
+		})
+	}
+}
+
+func TestCreateSubscriptionsCleansUp(t *testing.T) {
+	var created, deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && len(created) == 0:
+			created = append(created, "sub-1")
+			fmt.Fprint(w, `{"id": "sub-1"}`)
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, path.Base(r.URL.Path))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	receiver := &webhookv1.GitWatcher{
+		Spec: webhookv1.GitWatcherSpec{
+			Push: true,
+			PR:   true,
+		},
+	}
+	client := NewClient(server.Client(), server.URL, "access-token")
+	obj, err := (&AzureDevOps{}).createSubscriptions(context.Background(), receiver, client, &Repository{ID: "repo"})
+	if err == nil {
+		t.Fatal("expected the failed subscription to be reported")
+	}
+	if obj.Status.HookID != "" {
+		t.Errorf("expected no hook id, got %s", obj.Status.HookID)
+	}
+	if !reflect.DeepEqual(deleted, created) {
+		t.Errorf("expected subscriptions %v to be deleted, got %v", created, deleted)
+	}
+}
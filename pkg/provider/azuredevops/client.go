@@ -0,0 +1,182 @@
+package azuredevops
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/gitwatcher/pkg/provider"
+)
+
+const (
+	apiVersion = "5.1"
+	// changesPageSize is the number of changes requested at once when listing the changes of commits
+	changesPageSize = 1000
+)
+
+// Client is a minimal client for the Azure DevOps REST API of a single organization
+type Client struct {
+	api *provider.RESTClient
+}
+
+type Subscription struct {
+	ID               string            `json:"id,omitempty"`
+	PublisherID      string            `json:"publisherId"`
+	EventType        string            `json:"eventType"`
+	ResourceVersion  string            `json:"resourceVersion"`
+	ConsumerID       string            `json:"consumerId"`
+	ConsumerActionID string            `json:"consumerActionId"`
+	PublisherInputs  map[string]string `json:"publisherInputs"`
+	ConsumerInputs   map[string]string `json:"consumerInputs"`
+}
+
+type Project struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Repository struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	WebURL  string  `json:"webUrl"`
+	Project Project `json:"project"`
+}
+
+type Ref struct {
+	Name     string `json:"name"`
+	ObjectID string `json:"objectId"`
+}
+
+type refList struct {
+	Value []Ref `json:"value"`
+}
+
+// Change is a file or folder a commit changed, SourceServerItem is the original path of a renamed file
+type Change struct {
+	Item struct {
+		Path     string `json:"path"`
+		IsFolder bool   `json:"isFolder"`
+	} `json:"item"`
+	SourceServerItem string `json:"sourceServerItem"`
+}
+
+type commitDiffs struct {
+	AllChangesIncluded bool     `json:"allChangesIncluded"`
+	Changes            []Change `json:"changes"`
+}
+
+type commitChanges struct {
+	Changes []Change `json:"changes"`
+}
+
+// NewClient authenticates with a personal access token
+func NewClient(httpClient *http.Client, orgURL, token string) *Client {
+	api := provider.NewRESTClient(httpClient, orgURL, func(req *http.Request) {
+		req.SetBasicAuth("", token)
+	})
+	api.Query = url.Values{"api-version": {apiVersion}}
+	return &Client{
+		api: api,
+	}
+}
+
+// ParseRepositoryURL splits a dev.azure.com or visualstudio.com repository url into the
+// organization url, project and repository name
+func ParseRepositoryURL(repoURL string) (string, string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] != "_git" {
+			continue
+		}
+		orgPath := strings.Join(parts[:i-1], "/")
+		if orgPath != "" {
+			orgPath = "/" + orgPath
+		}
+		return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, orgPath), parts[i-1], strings.TrimSuffix(parts[i+1], ".git"), nil
+	}
+
+	return "", "", "", fmt.Errorf("failed to find project and repository in %s", repoURL)
+}
+
+func (c *Client) GetRepository(ctx context.Context, project, repo string) (*Repository, error) {
+	result := &Repository{}
+	err := c.api.Do(ctx, http.MethodGet, fmt.Sprintf("/%s/_apis/git/repositories/%s", url.PathEscape(project), url.PathEscape(repo)), nil, result, http.StatusOK)
+	return result, err
+}
+
+func (c *Client) GetBranch(ctx context.Context, repository *Repository, branch string) (*Ref, error) {
+	result := &refList{}
+	path := fmt.Sprintf("/%s/_apis/git/repositories/%s/refs?filter=%s", repository.Project.ID, repository.ID, url.QueryEscape("heads/"+branch))
+	if err := c.api.Do(ctx, http.MethodGet, path, nil, result, http.StatusOK); err != nil {
+		return nil, err
+	}
+	for _, ref := range result.Value {
+		if ref.Name == "refs/heads/"+branch {
+			return &ref, nil
+		}
+	}
+	return nil, fmt.Errorf("branch %s not found", branch)
+}
+
+// CompareCommits lists the changes of target since its merge base with base
+func (c *Client) CompareCommits(ctx context.Context, project, repo, base, target string) ([]Change, error) {
+	var changes []Change
+	for {
+		query := url.Values{
+			"baseVersion":       {base},
+			"baseVersionType":   {"commit"},
+			"targetVersion":     {target},
+			"targetVersionType": {"commit"},
+			"$top":              {strconv.Itoa(changesPageSize)},
+			"$skip":             {strconv.Itoa(len(changes))},
+		}
+		result := &commitDiffs{}
+		path := fmt.Sprintf("/%s/_apis/git/repositories/%s/diffs/commits?%s", url.PathEscape(project), url.PathEscape(repo), query.Encode())
+		if err := c.api.Do(ctx, http.MethodGet, path, nil, result, http.StatusOK); err != nil {
+			return nil, err
+		}
+		changes = append(changes, result.Changes...)
+		if result.AllChangesIncluded || len(result.Changes) == 0 {
+			return changes, nil
+		}
+	}
+}
+
+// GetCommitChanges lists the changes of commit against its first parent
+func (c *Client) GetCommitChanges(ctx context.Context, project, repo, commit string) ([]Change, error) {
+	var changes []Change
+	for {
+		query := url.Values{
+			"top":  {strconv.Itoa(changesPageSize)},
+			"skip": {strconv.Itoa(len(changes))},
+		}
+		result := &commitChanges{}
+		path := fmt.Sprintf("/%s/_apis/git/repositories/%s/commits/%s/changes?%s", url.PathEscape(project), url.PathEscape(repo), url.PathEscape(commit), query.Encode())
+		if err := c.api.Do(ctx, http.MethodGet, path, nil, result, http.StatusOK); err != nil {
+			return nil, err
+		}
+		changes = append(changes, result.Changes...)
+		if len(result.Changes) < changesPageSize {
+			return changes, nil
+		}
+	}
+}
+
+func (c *Client) CreateSubscription(ctx context.Context, subscription *Subscription) (*Subscription, error) {
+	result := &Subscription{}
+	err := c.api.Do(ctx, http.MethodPost, "/_apis/hooks/subscriptions", subscription, result, http.StatusOK)
+	return result, err
+}
+
+// DeleteSubscription removes a service hook subscription, one that is already gone is not an error
+func (c *Client) DeleteSubscription(ctx context.Context, id string) error {
+	return c.api.Do(ctx, http.MethodDelete, "/_apis/hooks/subscriptions/"+url.PathEscape(id), nil, nil, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
@@ -0,0 +1,64 @@
+package azuredevops
+
+import (
+	"encoding/json"
+)
+
+const (
+	eventPush               = "git.push"
+	eventPullRequestCreated = "git.pullrequest.created"
+	eventPullRequestUpdated = "git.pullrequest.updated"
+	eventPullRequestMerged  = "git.pullrequest.merged"
+)
+
+type event struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"eventType"`
+	Resource  json.RawMessage `json:"resource"`
+}
+
+type identity struct {
+	DisplayName string `json:"displayName"`
+	UniqueName  string `json:"uniqueName"`
+	ImageURL    string `json:"imageUrl"`
+}
+
+type repository struct {
+	ID     string `json:"id"`
+	WebURL string `json:"webUrl"`
+}
+
+type refUpdate struct {
+	Name        string `json:"name"`
+	OldObjectID string `json:"oldObjectId"`
+	NewObjectID string `json:"newObjectId"`
+}
+
+type commit struct {
+	CommitID string `json:"commitId"`
+	Comment  string `json:"comment"`
+	URL      string `json:"url"`
+	Author   struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+}
+
+type push struct {
+	RefUpdates []refUpdate `json:"refUpdates"`
+	Commits    []commit    `json:"commits"`
+	Repository repository  `json:"repository"`
+	PushedBy   identity    `json:"pushedBy"`
+}
+
+type pullRequest struct {
+	PullRequestID         int        `json:"pullRequestId"`
+	Status                string     `json:"status"`
+	MergeStatus           string     `json:"mergeStatus"`
+	Title                 string     `json:"title"`
+	Description           string     `json:"description"`
+	SourceRefName         string     `json:"sourceRefName"`
+	LastMergeSourceCommit commit     `json:"lastMergeSourceCommit"`
+	Repository            repository `json:"repository"`
+	CreatedBy             identity   `json:"createdBy"`
+}
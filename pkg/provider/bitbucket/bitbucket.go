@@ -0,0 +1,194 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/polling"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
+	"github.com/rancher/wrangler/pkg/kv"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventHeader     = "X-Event-Key"
+	hookUUIDHeader  = "X-Hook-UUID"
+	signatureHeader = "X-Hub-Signature"
+
+	cloudDeliveryHeader  = "X-Request-UUID"
+	serverDeliveryHeader = "X-Request-Id"
+)
+
+// zeroHash is the from hash of pushes creating a ref
+const zeroHash = "0000000000000000000000000000000000000000"
+
+const (
+	statusOpened = "opened"
+	statusClosed = "closed"
+	statusSynced = "synchronize"
+)
+
+// base holds what the Bitbucket Cloud and Bitbucket Server providers have in common,
+// both authenticate with the secret named by GithubWebhookToken and sign deliveries
+// with the GitWatcher token
+type base struct {
+	gitWatchers v1.GitWatcherController
+	gitCommits  v1.GitCommitController
+	secretCache corev1controller.SecretCache
+	configMaps  corev1controller.ConfigMapController
+	recorder    record.EventRecorder
+	httpClient  *http.Client
+	apply       apply.Apply
+}
+
+func newBase(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) base {
+	return base{
+		secretCache: secretCache,
+		configMaps:  configMaps,
+		recorder:    recorder,
+		gitCommits:  gitCommits,
+		gitWatchers: gitWatchers,
+		apply:       apply.WithStrictCaching(),
+		httpClient:  http.DefaultClient,
+	}
+}
+
+func (b *base) hasSecret(obj *webhookv1.GitWatcher) bool {
+	if obj.Spec.GithubWebhookToken == "" {
+		return false
+	}
+	_, err := b.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	return !errors2.IsNotFound(err)
+}
+
+func (b *base) getClient(obj *webhookv1.GitWatcher, baseURL string) (*Client, error) {
+	if obj.Spec.GithubWebhookToken == "" {
+		return nil, errors.New("bitbucket webhook token not found")
+	}
+	secret, err := b.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(b.httpClient, baseURL, secret.Data), nil
+}
+
+// receive looks up the GitWatcher a delivery is addressed to and returns its verified payload
+func (b *base) receive(ctx context.Context, req *http.Request) (*webhookv1.GitWatcher, []byte, int, error) {
+	receiverID := req.URL.Query().Get(utils.GitWebHookParam)
+	if receiverID == "" {
+		return nil, nil, 0, nil
+	}
+
+	ns, name := kv.Split(receiverID, ":")
+	gitwatcher, err := b.gitWatchers.Get(ns, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	if !gitwatcher.Spec.Enabled {
+		return nil, nil, http.StatusUnprocessableEntity, errors.New("webhook receiver is disabled")
+	}
+
+	gitwatcher, err = provider.LoadTokens(b.secretCache, gitwatcher)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	err = provider.Validate(ctx, func() error {
+		return provider.ValidateHMAC(payload, gitwatcher.Status.Token, req.Header.Get(signatureHeader))
+	})
+	if err != nil {
+		return nil, nil, http.StatusUnauthorized, err
+	}
+	if provider.ValidateOnly(ctx) {
+		return nil, nil, http.StatusAccepted, nil
+	}
+
+	return gitwatcher, payload, http.StatusOK, nil
+}
+
+func (b *base) applyFirstCommit(obj *webhookv1.GitWatcher, commit string) (*webhookv1.GitWatcher, error) {
+	if commit == "" {
+		return obj, nil
+	}
+	err := polling.ApplyCommit(obj, commit, b.apply)
+	obj = obj.DeepCopy()
+	obj.Status.FirstCommit = commit
+	return obj, err
+}
+
+// createCommits creates the GitCommits for every ref a push changed, returning the reason of the
+// last skipped ref when none qualified
+func (b *base) createCommits(ctx context.Context, receiver *webhookv1.GitWatcher, executions []*webhookv1.GitCommit, code int, err error) (int, error) {
+	if len(executions) == 0 {
+		if err == nil {
+			return http.StatusUnprocessableEntity, errors.New("push event has no changed refs")
+		}
+		return code, err
+	}
+
+	for _, execution := range executions {
+		if err := provider.CreateGitCommit(ctx, b.gitCommits, b.configMaps, b.recorder, receiver, execution); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// matchPaths records the files a push of a branch changed on execution, returning 422 when none of
+// them match the paths of receiver. Tags and receivers without path filters aren't checked.
+func matchPaths(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit, pushedFiles func() ([]string, error)) (int, error) {
+	if execution.Spec.Branch == "" || !provider.FiltersPaths(receiver) {
+		return 0, nil
+	}
+	files, err := pushedFiles()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := provider.MatchPaths(receiver, execution, files); err != nil {
+		return http.StatusUnprocessableEntity, err
+	}
+	return 0, nil
+}
+
+// applyRef fills in the branch or tag a push changed, checking them against the watcher's filters
+func applyRef(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit, refType, name string) (int, error) {
+	switch strings.ToLower(refType) {
+	case "branch":
+		if !receiver.Spec.Push {
+			return http.StatusUnprocessableEntity, fmt.Errorf("push watching is not currently turned on")
+		}
+		if err := git.BranchMatch(receiver.Spec.BranchInclude, receiver.Spec.BranchExclude, name); err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		execution.Spec.Branch = name
+	case "tag":
+		if !receiver.Spec.Tag {
+			return http.StatusUnprocessableEntity, fmt.Errorf("tag watching is not currently turned on")
+		}
+		if err := git.TagMatch(receiver.Spec.TagIncludeRegexp, receiver.Spec.TagExcludeRegexp, name); err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		execution.Spec.Tag = name
+	default:
+		return http.StatusUnprocessableEntity, fmt.Errorf("push event for %s refs is not supported", refType)
+	}
+	return 0, nil
+}
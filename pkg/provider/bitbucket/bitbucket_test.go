@@ -0,0 +1,174 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type fakeSecrets struct {
+	corev1controller.SecretCache
+}
+
+func (f *fakeSecrets) Get(namespace, name string) (*corev1.Secret, error) {
+	return &corev1.Secret{
+		Data: map[string][]byte{
+			"accessToken": []byte("access-token"),
+		},
+	}, nil
+}
+
+func testReceiver(repositoryURL string) *webhookv1.GitWatcher {
+	return &webhookv1.GitWatcher{
+		Spec: webhookv1.GitWatcherSpec{
+			RepositoryURL:      repositoryURL,
+			GithubWebhookToken: "bitbucket-credentials",
+			IncludePaths:       []string{"services/api"},
+		},
+	}
+}
+
+func TestCloudPushedFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldHash string
+		spec    string
+	}{
+		{
+			name:    "push to an existing branch",
+			oldHash: "abc",
+			spec:    "def..abc",
+		},
+		{
+			name: "push creating a branch",
+			spec: "def",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer access-token" || r.URL.Path != "/repositories/workspace/repo/diffstat/"+test.spec {
+					http.NotFound(w, r)
+					return
+				}
+				if r.URL.Query().Get("page") == "2" {
+					fmt.Fprint(w, `{"values": [{"old": {"path": "docs/README.md"}}]}`)
+					return
+				}
+				fmt.Fprintf(w, `{"values": [{"new": {"path": "services/api/main.go"}, "old": {"path": "services/api/main.go"}}, {"new": {"path": "services/web/new.go"}}], "next": "%s%s?page=2"}`, server.URL, r.URL.Path)
+			}))
+			defer server.Close()
+
+			w := &Bitbucket{
+				base:   base{secretCache: &fakeSecrets{}, httpClient: server.Client()},
+				apiURL: server.URL,
+			}
+			files, err := w.pushedFiles(context.Background(), testReceiver("https://bitbucket.org/workspace/repo"), "def", test.oldHash)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := []string{"services/api/main.go", "services/api/main.go", "services/web/new.go", "docs/README.md"}
+			if !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected files %v, got %v", expected, files)
+			}
+		})
+	}
+}
+
+func TestServerPushedFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		fromHash string
+		path     string
+		query    string
+	}{
+		{
+			name:     "push to an existing branch",
+			fromHash: "abc",
+			path:     "/rest/api/1.0/projects/PRJ/repos/repo/compare/changes",
+			query:    "from=def&limit=1000&to=abc",
+		},
+		{
+			name:     "push creating a branch",
+			fromHash: zeroHash,
+			path:     "/rest/api/1.0/projects/PRJ/repos/repo/commits/def/changes",
+			query:    "limit=1000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != test.path {
+					http.NotFound(w, r)
+					return
+				}
+				query := r.URL.Query()
+				start := query.Get("start")
+				query.Del("start")
+				switch {
+				case query.Encode() != test.query:
+					http.NotFound(w, r)
+				case start == "":
+					fmt.Fprint(w, `{"values": [{"path": {"toString": "services/api/main.go"}, "srcPath": {"toString": "services/api/old.go"}}], "isLastPage": false, "nextPageStart": 1}`)
+				case start == "1":
+					fmt.Fprint(w, `{"values": [{"path": {"toString": "docs/README.md"}}], "isLastPage": true}`)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			w := &BitbucketServer{
+				base: base{secretCache: &fakeSecrets{}, httpClient: server.Client()},
+			}
+			files, err := w.pushedFiles(context.Background(), testReceiver(server.URL+"/scm/PRJ/repo.git"), test.fromHash, "def")
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := []string{"services/api/main.go", "services/api/old.go", "docs/README.md"}
+			if !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected files %v, got %v", expected, files)
+			}
+		})
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	receiver := testReceiver("https://bitbucket.org/workspace/repo")
+	lookedUp := false
+	pushedFiles := func(files ...string) func() ([]string, error) {
+		return func() ([]string, error) {
+			lookedUp = true
+			return files, nil
+		}
+	}
+
+	execution := &webhookv1.GitCommit{Spec: webhookv1.GitCommitSpec{Branch: "main"}}
+	if code, err := matchPaths(receiver, execution, pushedFiles("services/web/main.go")); code != http.StatusUnprocessableEntity || err == nil {
+		t.Errorf("expected a push not changing services/api to be skipped, got %d: %v", code, err)
+	}
+
+	execution = &webhookv1.GitCommit{Spec: webhookv1.GitCommitSpec{Branch: "main"}}
+	if code, err := matchPaths(receiver, execution, pushedFiles("services/api/main.go")); code != 0 || err != nil {
+		t.Errorf("expected a push changing services/api to match, got %d: %v", code, err)
+	}
+	if !reflect.DeepEqual(execution.Spec.ChangedFiles, []string{"services/api/main.go"}) {
+		t.Errorf("expected the changed files to be recorded, got %v", execution.Spec.ChangedFiles)
+	}
+
+	lookedUp = false
+	execution = &webhookv1.GitCommit{Spec: webhookv1.GitCommitSpec{Tag: "v1.0.0"}}
+	if code, err := matchPaths(receiver, execution, pushedFiles()); code != 0 || err != nil || lookedUp {
+		t.Errorf("expected tags not to be filtered by paths, got %d: %v", code, err)
+	}
+}
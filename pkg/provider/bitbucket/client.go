@@ -0,0 +1,29 @@
+package bitbucket
+
+import (
+	"net/http"
+
+	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
+)
+
+// Client is a minimal REST client shared by the Bitbucket Cloud and Bitbucket Server APIs
+type Client struct {
+	api *provider.RESTClient
+}
+
+// NewClient authenticates with the accessToken key of secretData as a bearer token,
+// falling back to the username and password keys for app passwords
+func NewClient(httpClient *http.Client, baseURL string, secretData map[string][]byte) *Client {
+	token := string(secretData["accessToken"])
+	username, password := string(secretData[git.BasicAuthUsernameKey]), string(secretData[git.BasicAuthPasswordKey])
+	return &Client{
+		api: provider.NewRESTClient(httpClient, baseURL, func(req *http.Request) {
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			} else if username != "" {
+				req.SetBasicAuth(username, password)
+			}
+		}),
+	}
+}
@@ -0,0 +1,330 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
+	"github.com/rancher/wrangler/pkg/kv"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	bitbucketURL = "https://bitbucket.org"
+	cloudAPIURL  = "https://api.bitbucket.org/2.0"
+)
+
+// Bitbucket is the provider for repositories hosted on Bitbucket Cloud
+type Bitbucket struct {
+	base
+	apiURL string
+}
+
+func NewBitbucket(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *Bitbucket {
+	return &Bitbucket{
+		base:   newBase(apply, gitCommits, gitWatchers, secretCache, configMaps, recorder),
+		apiURL: cloudAPIURL,
+	}
+}
+
+func (w *Bitbucket) Supports(obj *webhookv1.GitWatcher) bool {
+	if !w.hasSecret(obj) {
+		return false
+	}
+
+	if strings.EqualFold(obj.Spec.Provider, "bitbucket") {
+		return true
+	}
+
+	if strings.HasPrefix(obj.Spec.RepositoryURL, bitbucketURL) {
+		return true
+	}
+
+	return false
+}
+
+func (w *Bitbucket) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.HookID != "" {
+		return obj, nil
+	}
+
+	client, err := w.getClient(obj, w.apiURL)
+	if err != nil {
+		return obj, err
+	}
+
+	workspace, repo, err := cloudRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	obj, err = w.createHook(ctx, obj, client, workspace, repo)
+	if err != nil {
+		return obj, err
+	}
+
+	if obj.Status.FirstCommit != "" || obj.Spec.Branch == "" {
+		return obj, nil
+	}
+
+	branch := &cloudRef{}
+	path := fmt.Sprintf("/repositories/%s/%s/refs/branches/%s", workspace, repo, url.PathEscape(obj.Spec.Branch))
+	if err := client.api.Do(ctx, http.MethodGet, path, nil, branch, http.StatusOK); err != nil {
+		return obj, fmt.Errorf("failed to get branch for %s/%s, error: %v", workspace, repo, err)
+	}
+
+	return w.applyFirstCommit(obj, branch.Target.Hash)
+}
+
+func (w *Bitbucket) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	if obj.Status.HookID == "" {
+		return nil
+	}
+
+	client, err := w.getClient(obj, w.apiURL)
+	if err != nil {
+		return err
+	}
+
+	workspace, repo, err := cloudRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/repositories/%s/%s/hooks/%s", workspace, repo, url.PathEscape(obj.Status.HookID))
+	if err := client.api.Do(ctx, http.MethodDelete, path, nil, nil, http.StatusNoContent, http.StatusNotFound); err != nil {
+		return fmt.Errorf("failed to delete hook for %s/%s, error: %v", workspace, repo, err)
+	}
+	return nil
+}
+
+func (w *Bitbucket) createHook(ctx context.Context, obj *webhookv1.GitWatcher, client *Client, workspace, repo string) (*webhookv1.GitWatcher, error) {
+	obj = obj.DeepCopy()
+	obj.Status.Token = uuid.New().String()
+
+	hook := &cloudHook{}
+	path := fmt.Sprintf("/repositories/%s/%s/hooks", workspace, repo)
+	err := client.api.Do(ctx, http.MethodPost, path, &cloudHook{
+		Description: "gitwatcher",
+		URL:         provider.HookEndpoint(obj),
+		Active:      true,
+		Secret:      obj.Status.Token,
+		Events:      getCloudEvents(obj),
+	}, hook, http.StatusCreated)
+	if err != nil {
+		return obj, fmt.Errorf("failed to create hook for %s/%s, error: %v", workspace, repo, err)
+	}
+
+	obj.Status.HookID = hook.UUID
+	return obj, nil
+}
+
+func getCloudEvents(obj *webhookv1.GitWatcher) []string {
+	var events []string
+	if obj.Spec.Push || obj.Spec.Tag {
+		events = append(events, "repo:push")
+	}
+
+	if obj.Spec.PR {
+		events = append(events,
+			"pullrequest:created",
+			"pullrequest:updated",
+			"pullrequest:fulfilled",
+			"pullrequest:rejected")
+	}
+
+	if len(events) == 0 {
+		// like GitHub, a hook without events defaults to pushes
+		events = append(events, "repo:push")
+	}
+	return events
+}
+
+func (w *Bitbucket) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	eventType := req.Header.Get(eventHeader)
+	if eventType == "" || req.Header.Get(hookUUIDHeader) == "" {
+		return 0, nil
+	}
+
+	gitwatcher, payload, code, err := w.receive(ctx, req)
+	if gitwatcher == nil {
+		return code, err
+	}
+
+	ctx = provider.WithDelivery(ctx, provider.Delivery{
+		EventType: eventType,
+		ID:        req.Header.Get(cloudDeliveryHeader),
+		Payload:   payload,
+	})
+	return w.handleEvent(ctx, eventType, payload, gitwatcher)
+}
+
+func (w *Bitbucket) handleEvent(ctx context.Context, eventType string, payload []byte, receiver *webhookv1.GitWatcher) (int, error) {
+	if eventType == "repo:push" {
+		return w.handlePush(ctx, payload, receiver)
+	}
+
+	if !strings.HasPrefix(eventType, "pullrequest:") {
+		return http.StatusUnprocessableEntity, fmt.Errorf("event %s is not supported", eventType)
+	}
+
+	if !receiver.Spec.PR {
+		return http.StatusUnprocessableEntity, fmt.Errorf("pull request is not enabled")
+	}
+
+	parsed := &cloudPullRequestEvent{}
+	if err := json.Unmarshal(payload, parsed); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	execution := provider.NewGitCommit(receiver)
+	switch eventType {
+	case "pullrequest:created":
+		execution.Spec.Action = statusOpened
+	case "pullrequest:updated":
+		execution.Spec.Action = statusSynced
+	case "pullrequest:fulfilled":
+		execution.Spec.Action = statusClosed
+		execution.Spec.Merged = true
+	case "pullrequest:rejected":
+		execution.Spec.Action = statusClosed
+	default:
+		return http.StatusUnprocessableEntity, fmt.Errorf("action %s ommitted", eventType)
+	}
+
+	setCloudAuthor(execution, parsed.Actor)
+	pr := parsed.PullRequest
+	execution.Spec.PR = strconv.Itoa(pr.ID)
+	execution.Spec.Title = pr.Title
+	execution.Spec.Message = pr.Description
+	execution.Spec.SourceLink = pr.Links.HTML.Href
+	execution.Spec.Commit = pr.Source.Commit.Hash
+
+	if execution.Spec.Action == statusClosed {
+		execution.Spec.Closed = true
+	}
+
+	if parsed.Repository.Links.HTML.Href != "" {
+		execution.Spec.RepositoryURL = parsed.Repository.Links.HTML.Href
+	}
+
+	return w.createCommits(ctx, receiver, []*webhookv1.GitCommit{execution}, 0, nil)
+}
+
+func (w *Bitbucket) handlePush(ctx context.Context, payload []byte, receiver *webhookv1.GitWatcher) (int, error) {
+	parsed := &cloudPushEvent{}
+	if err := json.Unmarshal(payload, parsed); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	var (
+		executions []*webhookv1.GitCommit
+		code       int
+		err        error
+	)
+	for _, change := range parsed.Push.Changes {
+		if change.New == nil {
+			code, err = http.StatusUnprocessableEntity, fmt.Errorf("push event only handles created or updated refs")
+			continue
+		}
+
+		execution := provider.NewGitCommit(receiver)
+		if code, err = applyRef(receiver, execution, change.New.Type, change.New.Name); err != nil {
+			continue
+		}
+		newHash, oldHash := change.New.Target.Hash, ""
+		if change.Old != nil {
+			oldHash = change.Old.Target.Hash
+		}
+		code, err = matchPaths(receiver, execution, func() ([]string, error) {
+			return w.pushedFiles(ctx, receiver, newHash, oldHash)
+		})
+		if code == http.StatusInternalServerError {
+			return code, err
+		} else if err != nil {
+			continue
+		}
+		setCloudAuthor(execution, parsed.Actor)
+		execution.Spec.Commit = change.New.Target.Hash
+		execution.Spec.Message = change.New.Target.Message
+		execution.Spec.SourceLink = change.New.Target.Links.HTML.Href
+		executions = append(executions, execution)
+	}
+
+	return w.createCommits(ctx, receiver, executions, code, err)
+}
+
+// pushedFiles lists the files changed by a push through the diffstat API, as push events don't list
+// them. A push creating a branch is compared against the parent of its head commit.
+func (w *Bitbucket) pushedFiles(ctx context.Context, receiver *webhookv1.GitWatcher, newHash, oldHash string) ([]string, error) {
+	client, err := w.getClient(receiver, w.apiURL)
+	if err != nil {
+		return nil, err
+	}
+	workspace, repo, err := cloudRepo(receiver.Spec.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bitbucket reads a..b as the changes of a since its merge base with b
+	spec := newHash
+	if oldHash != "" {
+		spec = newHash + ".." + oldHash
+	}
+
+	var files []string
+	path := fmt.Sprintf("/repositories/%s/%s/diffstat/%s?pagelen=500", workspace, repo, url.PathEscape(spec))
+	for path != "" {
+		diffStat := &cloudDiffStat{}
+		if err := client.api.Do(ctx, http.MethodGet, path, nil, diffStat, http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to get diffstat %s of %s/%s, error: %v", spec, workspace, repo, err)
+		}
+		for _, value := range diffStat.Values {
+			if value.New != nil {
+				files = append(files, value.New.Path)
+			}
+			if value.Old != nil {
+				files = append(files, value.Old.Path)
+			}
+		}
+
+		path = ""
+		if diffStat.Next != "" {
+			if !strings.HasPrefix(diffStat.Next, client.api.BaseURL) {
+				return nil, fmt.Errorf("unexpected next page %s of diffstat %s", diffStat.Next, spec)
+			}
+			path = strings.TrimPrefix(diffStat.Next, client.api.BaseURL)
+		}
+	}
+	return files, nil
+}
+
+func setCloudAuthor(execution *webhookv1.GitCommit, actor cloudActor) {
+	execution.Spec.Author = actor.Nickname
+	execution.Spec.AuthorAvatar = actor.Links.Avatar.Href
+}
+
+// cloudRepo returns the workspace and repository slug of a Bitbucket Cloud url
+func cloudRepo(repoURL string) (string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	repo := strings.Trim(u.Path, "/")
+	repo = strings.TrimSuffix(repo, ".git")
+	workspace, repo := kv.Split(repo, "/")
+	if workspace == "" || repo == "" {
+		return "", "", fmt.Errorf("failed to find workspace and repository in %s", repoURL)
+	}
+	return workspace, repo, nil
+}
@@ -0,0 +1,153 @@
+package bitbucket
+
+type link struct {
+	Href string `json:"href"`
+}
+
+type cloudHook struct {
+	UUID        string   `json:"uuid,omitempty"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Active      bool     `json:"active"`
+	Secret      string   `json:"secret,omitempty"`
+	Events      []string `json:"events"`
+}
+
+type cloudActor struct {
+	DisplayName string `json:"display_name"`
+	Nickname    string `json:"nickname"`
+	Links       struct {
+		Avatar link `json:"avatar"`
+	} `json:"links"`
+}
+
+type cloudRepository struct {
+	Links struct {
+		HTML link `json:"html"`
+	} `json:"links"`
+}
+
+type cloudCommit struct {
+	Hash    string `json:"hash"`
+	Message string `json:"message"`
+	Links   struct {
+		HTML link `json:"html"`
+	} `json:"links"`
+}
+
+type cloudRef struct {
+	Type   string      `json:"type"`
+	Name   string      `json:"name"`
+	Target cloudCommit `json:"target"`
+}
+
+type cloudDiffStatPath struct {
+	Path string `json:"path"`
+}
+
+// cloudDiffStat is a page of the files changed between two commits
+type cloudDiffStat struct {
+	Values []struct {
+		Old *cloudDiffStatPath `json:"old"`
+		New *cloudDiffStatPath `json:"new"`
+	} `json:"values"`
+	Next string `json:"next"`
+}
+
+type cloudPushEvent struct {
+	Actor      cloudActor      `json:"actor"`
+	Repository cloudRepository `json:"repository"`
+	Push       struct {
+		Changes []struct {
+			New *cloudRef `json:"new"`
+			Old *cloudRef `json:"old"`
+		} `json:"changes"`
+	} `json:"push"`
+}
+
+type cloudPullRequestEvent struct {
+	Actor       cloudActor      `json:"actor"`
+	Repository  cloudRepository `json:"repository"`
+	PullRequest struct {
+		ID          int    `json:"id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		State       string `json:"state"`
+		Links       struct {
+			HTML link `json:"html"`
+		} `json:"links"`
+		Source struct {
+			Branch struct {
+				Name string `json:"name"`
+			} `json:"branch"`
+			Commit struct {
+				Hash string `json:"hash"`
+			} `json:"commit"`
+		} `json:"source"`
+	} `json:"pullrequest"`
+}
+
+type serverHook struct {
+	ID            int               `json:"id,omitempty"`
+	Name          string            `json:"name"`
+	URL           string            `json:"url"`
+	Active        bool              `json:"active"`
+	Events        []string          `json:"events"`
+	Configuration map[string]string `json:"configuration,omitempty"`
+}
+
+type serverUser struct {
+	Name         string `json:"name"`
+	EmailAddress string `json:"emailAddress"`
+	DisplayName  string `json:"displayName"`
+}
+
+type serverRef struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	Type         string `json:"type"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+type serverBranches struct {
+	Values []serverRef `json:"values"`
+}
+
+type serverPath struct {
+	ToString string `json:"toString"`
+}
+
+// serverChanges is a page of the files changed between two commits
+type serverChanges struct {
+	Values []struct {
+		Path    serverPath  `json:"path"`
+		SrcPath *serverPath `json:"srcPath"`
+	} `json:"values"`
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+type serverPushEvent struct {
+	Actor   serverUser `json:"actor"`
+	Changes []struct {
+		Ref      serverRef `json:"ref"`
+		RefID    string    `json:"refId"`
+		FromHash string    `json:"fromHash"`
+		ToHash   string    `json:"toHash"`
+		Type     string    `json:"type"`
+	} `json:"changes"`
+}
+
+type serverPullRequestEvent struct {
+	Actor       serverUser `json:"actor"`
+	PullRequest struct {
+		ID          int       `json:"id"`
+		Title       string    `json:"title"`
+		Description string    `json:"description"`
+		State       string    `json:"state"`
+		FromRef     serverRef `json:"fromRef"`
+		Links       struct {
+			Self []link `json:"self"`
+		} `json:"links"`
+	} `json:"pullRequest"`
+}
@@ -0,0 +1,337 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	serverAPIPath = "/rest/api/1.0"
+)
+
+// BitbucketServer is the provider for repositories hosted on Bitbucket Server or Data Center
+type BitbucketServer struct {
+	base
+}
+
+func NewBitbucketServer(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *BitbucketServer {
+	return &BitbucketServer{
+		base: newBase(apply, gitCommits, gitWatchers, secretCache, configMaps, recorder),
+	}
+}
+
+func (w *BitbucketServer) Supports(obj *webhookv1.GitWatcher) bool {
+	if !w.hasSecret(obj) {
+		return false
+	}
+
+	return strings.EqualFold(obj.Spec.Provider, "bitbucket-server")
+}
+
+func (w *BitbucketServer) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.HookID != "" {
+		return obj, nil
+	}
+
+	baseURL, repoPath, err := serverRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	client, err := w.getClient(obj, baseURL)
+	if err != nil {
+		return obj, err
+	}
+
+	obj, err = w.createHook(ctx, obj, client, repoPath)
+	if err != nil {
+		return obj, err
+	}
+
+	if obj.Status.FirstCommit != "" || obj.Spec.Branch == "" {
+		return obj, nil
+	}
+
+	branches := &serverBranches{}
+	path := fmt.Sprintf("%s/branches?filterText=%s", repoPath, url.QueryEscape(obj.Spec.Branch))
+	if err := client.api.Do(ctx, http.MethodGet, path, nil, branches, http.StatusOK); err != nil {
+		return obj, fmt.Errorf("failed to get branch for %s, error: %v", repoPath, err)
+	}
+
+	for _, branch := range branches.Values {
+		if branch.DisplayID == obj.Spec.Branch {
+			return w.applyFirstCommit(obj, branch.LatestCommit)
+		}
+	}
+	return obj, nil
+}
+
+func (w *BitbucketServer) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	if obj.Status.HookID == "" {
+		return nil
+	}
+
+	baseURL, repoPath, err := serverRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	client, err := w.getClient(obj, baseURL)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/webhooks/%s", repoPath, url.PathEscape(obj.Status.HookID))
+	if err := client.api.Do(ctx, http.MethodDelete, path, nil, nil, http.StatusNoContent, http.StatusNotFound); err != nil {
+		return fmt.Errorf("failed to delete hook for %s, error: %v", repoPath, err)
+	}
+	return nil
+}
+
+func (w *BitbucketServer) createHook(ctx context.Context, obj *webhookv1.GitWatcher, client *Client, repoPath string) (*webhookv1.GitWatcher, error) {
+	obj = obj.DeepCopy()
+	obj.Status.Token = uuid.New().String()
+
+	hook := &serverHook{}
+	err := client.api.Do(ctx, http.MethodPost, repoPath+"/webhooks", &serverHook{
+		Name:   "gitwatcher",
+		URL:    provider.HookEndpoint(obj),
+		Active: true,
+		Events: getServerEvents(obj),
+		Configuration: map[string]string{
+			"secret": obj.Status.Token,
+		},
+	}, hook, http.StatusCreated)
+	if err != nil {
+		return obj, fmt.Errorf("failed to create hook for %s, error: %v", repoPath, err)
+	}
+
+	if hook.ID != 0 {
+		obj.Status.HookID = strconv.Itoa(hook.ID)
+	}
+	return obj, nil
+}
+
+func getServerEvents(obj *webhookv1.GitWatcher) []string {
+	var events []string
+	if obj.Spec.Push || obj.Spec.Tag {
+		events = append(events, "repo:refs_changed")
+	}
+
+	if obj.Spec.PR {
+		events = append(events,
+			"pr:opened",
+			"pr:from_ref_updated",
+			"pr:merged",
+			"pr:declined")
+	}
+
+	if len(events) == 0 {
+		// like GitHub, a hook without events defaults to pushes
+		events = append(events, "repo:refs_changed")
+	}
+	return events
+}
+
+func (w *BitbucketServer) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	eventType := req.Header.Get(eventHeader)
+	if eventType == "" || req.Header.Get(hookUUIDHeader) != "" {
+		return 0, nil
+	}
+
+	gitwatcher, payload, code, err := w.receive(ctx, req)
+	if gitwatcher == nil {
+		return code, err
+	}
+
+	ctx = provider.WithDelivery(ctx, provider.Delivery{
+		EventType: eventType,
+		ID:        req.Header.Get(serverDeliveryHeader),
+		Payload:   payload,
+	})
+	return w.handleEvent(ctx, eventType, payload, gitwatcher)
+}
+
+func (w *BitbucketServer) handleEvent(ctx context.Context, eventType string, payload []byte, receiver *webhookv1.GitWatcher) (int, error) {
+	switch eventType {
+	case "diagnostics:ping":
+		return http.StatusOK, nil
+	case "repo:refs_changed":
+		return w.handlePush(ctx, payload, receiver)
+	}
+
+	if !strings.HasPrefix(eventType, "pr:") {
+		return http.StatusUnprocessableEntity, fmt.Errorf("event %s is not supported", eventType)
+	}
+
+	if !receiver.Spec.PR {
+		return http.StatusUnprocessableEntity, fmt.Errorf("pull request is not enabled")
+	}
+
+	parsed := &serverPullRequestEvent{}
+	if err := json.Unmarshal(payload, parsed); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	execution := provider.NewGitCommit(receiver)
+	switch eventType {
+	case "pr:opened":
+		execution.Spec.Action = statusOpened
+	case "pr:from_ref_updated":
+		execution.Spec.Action = statusSynced
+	case "pr:merged":
+		execution.Spec.Action = statusClosed
+		execution.Spec.Merged = true
+	case "pr:declined":
+		execution.Spec.Action = statusClosed
+	default:
+		return http.StatusUnprocessableEntity, fmt.Errorf("action %s ommitted", eventType)
+	}
+
+	setServerAuthor(execution, parsed.Actor)
+	pr := parsed.PullRequest
+	execution.Spec.PR = strconv.Itoa(pr.ID)
+	execution.Spec.Title = pr.Title
+	execution.Spec.Message = pr.Description
+	execution.Spec.Commit = pr.FromRef.LatestCommit
+	if len(pr.Links.Self) > 0 {
+		execution.Spec.SourceLink = pr.Links.Self[0].Href
+	}
+
+	if execution.Spec.Action == statusClosed {
+		execution.Spec.Closed = true
+	}
+
+	return w.createCommits(ctx, receiver, []*webhookv1.GitCommit{execution}, 0, nil)
+}
+
+func (w *BitbucketServer) handlePush(ctx context.Context, payload []byte, receiver *webhookv1.GitWatcher) (int, error) {
+	parsed := &serverPushEvent{}
+	if err := json.Unmarshal(payload, parsed); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	var (
+		executions []*webhookv1.GitCommit
+		code       int
+		err        error
+	)
+	for _, change := range parsed.Changes {
+		if change.Type == "DELETE" {
+			code, err = http.StatusUnprocessableEntity, fmt.Errorf("push event only handles created or updated refs")
+			continue
+		}
+
+		execution := provider.NewGitCommit(receiver)
+		if code, err = applyRef(receiver, execution, change.Ref.Type, change.Ref.DisplayID); err != nil {
+			continue
+		}
+		fromHash, toHash := change.FromHash, change.ToHash
+		code, err = matchPaths(receiver, execution, func() ([]string, error) {
+			return w.pushedFiles(ctx, receiver, fromHash, toHash)
+		})
+		if code == http.StatusInternalServerError {
+			return code, err
+		} else if err != nil {
+			continue
+		}
+		setServerAuthor(execution, parsed.Actor)
+		execution.Spec.Commit = change.ToHash
+		executions = append(executions, execution)
+	}
+
+	return w.createCommits(ctx, receiver, executions, code, err)
+}
+
+// pushedFiles lists the files changed by a push through the API, as push events don't list them. A
+// push creating a branch is compared against the parent of its head commit.
+func (w *BitbucketServer) pushedFiles(ctx context.Context, receiver *webhookv1.GitWatcher, fromHash, toHash string) ([]string, error) {
+	baseURL, repoPath, err := serverRepo(receiver.Spec.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := w.getClient(receiver, baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// compare/changes lists the changes reachable from "from" but not from "to"
+	query := url.Values{"from": {toHash}, "to": {fromHash}}
+	path := repoPath + "/compare/changes"
+	if fromHash == "" || fromHash == zeroHash {
+		query = url.Values{}
+		path = fmt.Sprintf("%s/commits/%s/changes", repoPath, url.PathEscape(toHash))
+	}
+	query.Set("limit", "1000")
+
+	var files []string
+	for {
+		changes := &serverChanges{}
+		if err := client.api.Do(ctx, http.MethodGet, path+"?"+query.Encode(), nil, changes, http.StatusOK); err != nil {
+			return nil, fmt.Errorf("failed to get changes of %s..%s of %s, error: %v", fromHash, toHash, repoPath, err)
+		}
+		for _, value := range changes.Values {
+			files = append(files, value.Path.ToString)
+			if value.SrcPath != nil {
+				files = append(files, value.SrcPath.ToString)
+			}
+		}
+		if changes.IsLastPage || len(changes.Values) == 0 {
+			return files, nil
+		}
+		query.Set("start", strconv.Itoa(changes.NextPageStart))
+	}
+}
+
+func setServerAuthor(execution *webhookv1.GitCommit, actor serverUser) {
+	execution.Spec.Author = actor.Name
+	execution.Spec.AuthorEmail = actor.EmailAddress
+}
+
+// serverRepo splits a Bitbucket Server clone or browse url into the REST API base url and
+// the path of the repository below it, keeping any context path the server is deployed under
+func serverRepo(repoURL string) (string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i < len(parts)-2; i++ {
+		var project, repo string
+		switch {
+		case parts[i] == "scm":
+			project, repo = parts[i+1], parts[i+2]
+		case (parts[i] == "projects" || parts[i] == "users") && i+3 < len(parts) && parts[i+2] == "repos":
+			project, repo = parts[i+1], parts[i+3]
+			if parts[i] == "users" {
+				project = "~" + project
+			}
+		default:
+			continue
+		}
+
+		contextPath := strings.Join(parts[:i], "/")
+		if contextPath != "" {
+			contextPath = "/" + contextPath
+		}
+		baseURL := fmt.Sprintf("%s://%s%s%s", u.Scheme, u.Host, contextPath, serverAPIPath)
+		repoPath := fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(project), url.PathEscape(strings.TrimSuffix(repo, ".git")))
+		return baseURL, repoPath, nil
+	}
+
+	return "", "", fmt.Errorf("failed to find project and repository in %s", repoURL)
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/name"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MaxInlinePayloadSize is the largest payload kept in the GitCommit itself, larger ones go to a ConfigMap
+	MaxInlinePayloadSize = 16 * 1024
+	// MaxPayloadSize is the largest payload recorded at all, it stays well below the ConfigMap size limit
+	MaxPayloadSize = 512 * 1024
+
+	PayloadConfigMapKey = "payload"
+)
+
+type deliveryKey struct{}
+
+// Delivery is the raw webhook request a GitCommit is created from
+type Delivery struct {
+	EventType string
+	ID        string
+	Payload   []byte
+}
+
+// WithDelivery attaches the delivery being handled to ctx, GitCommits created with ctx record it
+func WithDelivery(ctx context.Context, delivery Delivery) context.Context {
+	if v, ok := ctx.Value(validationKey{}).(*validation); ok {
+		v.event = delivery.EventType
+	}
+	return context.WithValue(ctx, deliveryKey{}, delivery)
+}
+
+// DeliveryFrom returns the delivery attached to ctx
+func DeliveryFrom(ctx context.Context) (Delivery, bool) {
+	delivery, ok := ctx.Value(deliveryKey{}).(Delivery)
+	return delivery, ok
+}
+
+// recordDelivery fills in the event type, delivery id and, when small enough, the payload of the
+// delivery in ctx. It returns the payload still to be stored in a ConfigMap.
+func recordDelivery(ctx context.Context, execution *webhookv1.GitCommit) []byte {
+	delivery, ok := DeliveryFrom(ctx)
+	if !ok {
+		return nil
+	}
+
+	execution.Spec.EventType = delivery.EventType
+	execution.Spec.DeliveryID = delivery.ID
+	switch {
+	case len(delivery.Payload) <= MaxInlinePayloadSize:
+		execution.Spec.Payload = string(delivery.Payload)
+	case len(delivery.Payload) <= MaxPayloadSize:
+		return delivery.Payload
+	default:
+		logrus.Debugf("not recording %d byte payload of delivery %s, it exceeds %d bytes", len(delivery.Payload), delivery.ID, MaxPayloadSize)
+	}
+	return nil
+}
+
+// storePayload keeps a large payload in a ConfigMap owned by gitCommit and references it from the GitCommit
+func storePayload(gitCommits v1.GitCommitController, configMaps corev1controller.ConfigMapController, gitCommit *webhookv1.GitCommit, payload []byte) error {
+	configMapName := name.SafeConcatName(gitCommit.Name, PayloadConfigMapKey)
+	_, err := configMaps.Create(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: gitCommit.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: webhookv1.SchemeGroupVersion.String(),
+					Kind:       "GitCommit",
+					Name:       gitCommit.Name,
+					UID:        gitCommit.UID,
+				},
+			},
+		},
+		BinaryData: map[string][]byte{
+			PayloadConfigMapKey: payload,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store payload of gitcommit %s/%s: %v", gitCommit.Namespace, gitCommit.Name, err)
+	}
+
+	gitCommit = gitCommit.DeepCopy()
+	gitCommit.Spec.PayloadConfigMapName = configMapName
+	_, err = gitCommits.Update(gitCommit)
+	return err
+}
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"fmt"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events recorded on GitWatchers and GitCommits
+const (
+	EventHookCreated            = "HookCreated"
+	EventHookCreateFailed       = "HookCreateFailed"
+	EventPollFailed             = "PollFailed"
+	EventNewCommit              = "NewCommit"
+	EventGitCommitCreated       = "Created"
+	EventDeploymentStatusFailed = "DeploymentStatusFailed"
+	EventCommitStatusFailed     = "CommitStatusFailed"
+	EventCheckRunFailed         = "CheckRunFailed"
+)
+
+// RecordGitCommit records that gitCommit was created for receiver, on both of them
+func RecordGitCommit(recorder record.EventRecorder, receiver *webhookv1.GitWatcher, gitCommit *webhookv1.GitCommit) {
+	source := describeGitCommit(gitCommit)
+	recorder.Eventf(gitCommit, corev1.EventTypeNormal, EventGitCommitCreated, "Created from %s", source)
+	recorder.Eventf(receiver, corev1.EventTypeNormal, EventNewCommit, "Detected %s, created GitCommit %s", source, gitCommit.Name)
+}
+
+func describeGitCommit(gitCommit *webhookv1.GitCommit) string {
+	commit := gitCommit.Spec.Commit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+
+	switch {
+	case gitCommit.Spec.PR != "":
+		return fmt.Sprintf("pull request %s (%s) at commit %s", gitCommit.Spec.PR, gitCommit.Spec.Action, commit)
+	case gitCommit.Spec.Tag != "":
+		return fmt.Sprintf("tag %s at commit %s", gitCommit.Spec.Tag, commit)
+	default:
+		return fmt.Sprintf("push to branch %s at commit %s", gitCommit.Spec.Branch, commit)
+	}
+}
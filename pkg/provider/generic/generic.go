@@ -0,0 +1,216 @@
+package generic
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/kv"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	SchemeHMAC  = "hmac"
+	SchemeToken = "token"
+
+	defaultSignatureHeader = "X-Hub-Signature"
+)
+
+// Generic receives deliveries from senders gitwatcher has no dedicated provider for. Nothing is
+// registered remotely, the sender is configured by hand with the hook endpoint and the GitWatcher token.
+type Generic struct {
+	gitWatchers v1.GitWatcherController
+	gitCommits  v1.GitCommitController
+	secretCache corev1controller.SecretCache
+	configMaps  corev1controller.ConfigMapController
+	recorder    record.EventRecorder
+}
+
+func NewGeneric(gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *Generic {
+	return &Generic{
+		gitCommits:  gitCommits,
+		gitWatchers: gitWatchers,
+		secretCache: secretCache,
+		configMaps:  configMaps,
+		recorder:    recorder,
+	}
+}
+
+func (w *Generic) Supports(obj *webhookv1.GitWatcher) bool {
+	return strings.EqualFold(obj.Spec.Provider, "generic")
+}
+
+func (w *Generic) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.Token != "" {
+		return obj, nil
+	}
+
+	obj = obj.DeepCopy()
+	obj.Status.Token = uuid.New().String()
+	return obj, nil
+}
+
+func (w *Generic) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	return nil
+}
+
+// HandleHook claims deliveries by the provider of the GitWatcher they are addressed to, generic
+// senders have no headers of their own to recognize them by
+func (w *Generic) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	receiverID := req.URL.Query().Get(utils.GitWebHookParam)
+	if receiverID == "" {
+		return 0, nil
+	}
+
+	ns, name := kv.Split(receiverID, ":")
+	gitwatcher, err := w.gitWatchers.Get(ns, name, metav1.GetOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !w.Supports(gitwatcher) {
+		return 0, nil
+	}
+
+	if !gitwatcher.Spec.Enabled {
+		return http.StatusUnprocessableEntity, errors.New("webhook receiver is disabled")
+	}
+
+	gitwatcher, err = provider.LoadTokens(w.secretCache, gitwatcher)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if gitwatcher.Spec.Generic == nil {
+		return http.StatusUnprocessableEntity, errors.New("generic webhook is not configured")
+	}
+
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if strings.EqualFold(gitwatcher.Spec.Generic.Scheme, SchemeToken) {
+		provider.MarkCredentialHeader(ctx, signatureHeader(gitwatcher))
+	}
+	if err := provider.Validate(ctx, func() error { return validate(gitwatcher, req, payload) }); err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if provider.ValidateOnly(ctx) {
+		return http.StatusAccepted, nil
+	}
+
+	ctx = provider.WithDelivery(ctx, provider.Delivery{Payload: payload})
+	return w.handleEvent(ctx, payload, gitwatcher)
+}
+
+func signatureHeader(receiver *webhookv1.GitWatcher) string {
+	if receiver.Spec.Generic.SignatureHeader != "" {
+		return receiver.Spec.Generic.SignatureHeader
+	}
+	return defaultSignatureHeader
+}
+
+func validate(receiver *webhookv1.GitWatcher, req *http.Request, payload []byte) error {
+	signature := req.Header.Get(signatureHeader(receiver))
+
+	switch strings.ToLower(receiver.Spec.Generic.Scheme) {
+	case "", SchemeHMAC:
+		return provider.ValidateHMAC(payload, receiver.Status.Token, signature)
+	case SchemeToken:
+		if receiver.Status.Token == "" || subtle.ConstantTimeCompare([]byte(signature), []byte(receiver.Status.Token)) != 1 {
+			return errors.New("invalid webhook token")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported webhook scheme %s", receiver.Spec.Generic.Scheme)
+	}
+}
+
+func (w *Generic) handleEvent(ctx context.Context, payload []byte, receiver *webhookv1.GitWatcher) (int, error) {
+	var data interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	fields := receiver.Spec.Generic
+	execution := provider.NewGitCommit(receiver)
+	for _, field := range []struct {
+		path  string
+		value *string
+	}{
+		{fields.CommitPath, &execution.Spec.Commit},
+		{fields.BranchPath, &execution.Spec.Branch},
+		{fields.TagPath, &execution.Spec.Tag},
+		{fields.AuthorPath, &execution.Spec.Author},
+		{fields.MessagePath, &execution.Spec.Message},
+	} {
+		value, err := extract(field.path, data)
+		if err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		*field.value = value
+	}
+
+	if execution.Spec.Commit == "" {
+		return http.StatusUnprocessableEntity, fmt.Errorf("no commit found at %s", fields.CommitPath)
+	}
+
+	execution.Spec.Branch = strings.TrimPrefix(execution.Spec.Branch, "refs/heads/")
+	execution.Spec.Tag = strings.TrimPrefix(execution.Spec.Tag, "refs/tags/")
+	if execution.Spec.Tag != "" {
+		if !receiver.Spec.Tag {
+			return http.StatusUnprocessableEntity, fmt.Errorf("tag watching is not currently turned on")
+		}
+		err := git.TagMatch(receiver.Spec.TagIncludeRegexp, receiver.Spec.TagExcludeRegexp, execution.Spec.Tag)
+		if err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+	} else if execution.Spec.Branch != "" {
+		if err := git.BranchMatch(receiver.Spec.BranchInclude, receiver.Spec.BranchExclude, execution.Spec.Branch); err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+	}
+
+	if err := provider.CreateGitCommit(ctx, w.gitCommits, w.configMaps, w.recorder, receiver, execution); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// extract evaluates a JSONPath expression against data, a missing key yields an empty value
+func extract(path string, data interface{}) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+
+	jp := jsonpath.New("generic")
+	jp.AllowMissingKeys(true)
+	if err := jp.Parse(path); err != nil {
+		return "", fmt.Errorf("invalid jsonpath %s: %v", path, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := jp.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("failed to evaluate jsonpath %s: %v", path, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
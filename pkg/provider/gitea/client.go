@@ -0,0 +1,82 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rancher/gitwatcher/pkg/provider"
+)
+
+const (
+	apiPath = "/api/v1"
+)
+
+// Client is a minimal client for the API Gitea and Gogs share
+type Client struct {
+	api *provider.RESTClient
+}
+
+type Hook struct {
+	ID     int               `json:"id,omitempty"`
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+	Events []string          `json:"events"`
+	Active bool              `json:"active"`
+}
+
+type Branch struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+func NewClient(httpClient *http.Client, baseURL, token string) *Client {
+	return &Client{
+		api: provider.NewRESTClient(httpClient, baseURL, func(req *http.Request) {
+			req.Header.Set("Authorization", "token "+token)
+		}),
+	}
+}
+
+// ParseRepositoryURL returns the API endpoint of the instance hosting repoURL, keeping any
+// sub path it is served under, along with the repository owner and name
+func ParseRepositoryURL(repoURL string) (string, string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if u.Scheme == "" || u.Host == "" || len(parts) < 2 {
+		return "", "", "", fmt.Errorf("failed to find owner and repository in %s", repoURL)
+	}
+
+	owner := parts[len(parts)-2]
+	repo := strings.TrimSuffix(parts[len(parts)-1], ".git")
+	subPath := strings.Join(parts[:len(parts)-2], "/")
+	if subPath != "" {
+		subPath = "/" + subPath
+	}
+	return fmt.Sprintf("%s://%s%s%s", u.Scheme, u.Host, subPath, apiPath), owner, repo, nil
+}
+
+func (c *Client) CreateHook(ctx context.Context, owner, repo string, hook *Hook) (*Hook, error) {
+	result := &Hook{}
+	err := c.api.Do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/%s/hooks", owner, repo), hook, result, http.StatusCreated)
+	return result, err
+}
+
+// DeleteHook removes a repository hook, a hook that is already gone is not an error
+func (c *Client) DeleteHook(ctx context.Context, owner, repo, id string) error {
+	return c.api.Do(ctx, http.MethodDelete, fmt.Sprintf("/repos/%s/%s/hooks/%s", owner, repo, url.PathEscape(id)), nil, nil, http.StatusNoContent, http.StatusNotFound)
+}
+
+func (c *Client) GetBranch(ctx context.Context, owner, repo, branch string) (*Branch, error) {
+	result := &Branch{}
+	err := c.api.Do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/%s/branches/%s", owner, repo, url.PathEscape(branch)), nil, result, http.StatusOK)
+	return result, err
+}
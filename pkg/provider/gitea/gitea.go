@@ -0,0 +1,366 @@
+package gitea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v28/github"
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/polling"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
+	"github.com/rancher/wrangler/pkg/kv"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	giteaEventHeader     = "X-Gitea-Event"
+	giteaSignatureHeader = "X-Gitea-Signature"
+	gogsEventHeader      = "X-Gogs-Event"
+	gogsSignatureHeader  = "X-Gogs-Signature"
+	giteaDeliveryHeader  = "X-Gitea-Delivery"
+	gogsDeliveryHeader   = "X-Gogs-Delivery"
+)
+
+const (
+	statusOpened   = "opened"
+	statusReopened = "reopened"
+	statusClosed   = "closed"
+	statusSynced   = "synchronize"
+	// Gitea reports new commits on a pull request as synchronized rather than synchronize
+	statusGiteaSynced = "synchronized"
+)
+
+// Gitea handles repositories on Gitea and Gogs, whose payloads follow the GitHub format
+type Gitea struct {
+	gitWatchers v1.GitWatcherController
+	gitCommits  v1.GitCommitController
+	secretCache corev1controller.SecretCache
+	configMaps  corev1controller.ConfigMapController
+	recorder    record.EventRecorder
+	httpClient  *http.Client
+	apply       apply.Apply
+}
+
+func NewGitea(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *Gitea {
+	return &Gitea{
+		secretCache: secretCache,
+		configMaps:  configMaps,
+		recorder:    recorder,
+		gitCommits:  gitCommits,
+		gitWatchers: gitWatchers,
+		apply:       apply.WithStrictCaching(),
+		httpClient:  http.DefaultClient,
+	}
+}
+
+func (w *Gitea) Supports(obj *webhookv1.GitWatcher) bool {
+	if obj.Spec.GithubWebhookToken == "" {
+		return false
+	}
+	_, err := w.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if errors2.IsNotFound(err) {
+		return false
+	}
+
+	return strings.EqualFold(obj.Spec.Provider, "gitea") || strings.EqualFold(obj.Spec.Provider, "gogs")
+}
+
+func (w *Gitea) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.HookID != "" {
+		return obj, nil
+	}
+
+	baseURL, owner, repo, err := ParseRepositoryURL(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	client, err := w.getClient(obj, baseURL)
+	if err != nil {
+		return obj, err
+	}
+
+	obj, err = w.createHook(ctx, obj, client, owner, repo)
+	if err != nil {
+		return obj, err
+	}
+
+	return w.getFirstCommit(ctx, obj, client, owner, repo)
+}
+
+func (w *Gitea) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	if obj.Status.HookID == "" {
+		return nil
+	}
+
+	baseURL, owner, repo, err := ParseRepositoryURL(obj.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	client, err := w.getClient(obj, baseURL)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteHook(ctx, owner, repo, obj.Status.HookID); err != nil {
+		return fmt.Errorf("failed to delete hook for %s/%s, error: %v", owner, repo, err)
+	}
+	return nil
+}
+
+func (w *Gitea) getFirstCommit(ctx context.Context, obj *webhookv1.GitWatcher, client *Client, owner, repo string) (*webhookv1.GitWatcher, error) {
+	if obj.Status.FirstCommit != "" || obj.Spec.Branch == "" {
+		return obj, nil
+	}
+
+	branch, err := client.GetBranch(ctx, owner, repo, obj.Spec.Branch)
+	if err != nil {
+		return obj, fmt.Errorf("failed to get branch for %s/%s, error: %v", owner, repo, err)
+	}
+
+	if branch.Commit.ID == "" {
+		return obj, nil
+	}
+
+	err = polling.ApplyCommit(obj, branch.Commit.ID, w.apply)
+	obj = obj.DeepCopy()
+	obj.Status.FirstCommit = branch.Commit.ID
+	return obj, err
+}
+
+func (w *Gitea) createHook(ctx context.Context, obj *webhookv1.GitWatcher, client *Client, owner, repo string) (*webhookv1.GitWatcher, error) {
+	obj = obj.DeepCopy()
+	obj.Status.Token = uuid.New().String()
+
+	hookType := "gitea"
+	if strings.EqualFold(obj.Spec.Provider, "gogs") {
+		hookType = "gogs"
+	}
+
+	hook, err := client.CreateHook(ctx, owner, repo, &Hook{
+		Type: hookType,
+		Config: map[string]string{
+			"url":          provider.HookEndpoint(obj),
+			"content_type": "json",
+			"secret":       obj.Status.Token,
+		},
+		Events: getEvents(obj),
+		Active: true,
+	})
+	if err != nil {
+		return obj, fmt.Errorf("failed to create hook for %s/%s, error: %v", owner, repo, err)
+	}
+
+	if hook.ID != 0 {
+		obj.Status.HookID = strconv.Itoa(hook.ID)
+	}
+
+	return obj, nil
+}
+
+func getEvents(obj *webhookv1.GitWatcher) []string {
+	var events []string
+	if obj.Spec.Push {
+		events = append(events, "push")
+	}
+
+	if obj.Spec.PR {
+		events = append(events, "pull_request")
+	}
+
+	if obj.Spec.Tag {
+		events = append(events, "create")
+	}
+	return events
+}
+
+func (w *Gitea) getClient(obj *webhookv1.GitWatcher, baseURL string) (*Client, error) {
+	if obj.Spec.GithubWebhookToken == "" {
+		return nil, errors.New("gitea webhook token not found")
+	}
+	secret, err := w.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(w.httpClient, baseURL, string(secret.Data["accessToken"])), nil
+}
+
+func (w *Gitea) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	eventType, signature, deliveryID := req.Header.Get(giteaEventHeader), req.Header.Get(giteaSignatureHeader), req.Header.Get(giteaDeliveryHeader)
+	if eventType == "" {
+		eventType, signature, deliveryID = req.Header.Get(gogsEventHeader), req.Header.Get(gogsSignatureHeader), req.Header.Get(gogsDeliveryHeader)
+	}
+	if eventType == "" {
+		return 0, nil
+	}
+
+	receiverID := req.URL.Query().Get(utils.GitWebHookParam)
+	if receiverID == "" {
+		return 0, nil
+	}
+
+	ns, name := kv.Split(receiverID, ":")
+	gitwatcher, err := w.gitWatchers.Get(ns, name, metav1.GetOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !gitwatcher.Spec.Enabled {
+		return http.StatusUnprocessableEntity, errors.New("webhook receiver is disabled")
+	}
+
+	gitwatcher, err = provider.LoadTokens(w.secretCache, gitwatcher)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	err = provider.Validate(ctx, func() error {
+		return provider.ValidateHMAC(payload, gitwatcher.Status.Token, signature)
+	})
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if provider.ValidateOnly(ctx) {
+		return http.StatusAccepted, nil
+	}
+
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		return http.StatusUnprocessableEntity, err
+	}
+
+	ctx = provider.WithDelivery(ctx, provider.Delivery{
+		EventType: eventType,
+		ID:        deliveryID,
+		Payload:   payload,
+	})
+	return w.handleEvent(ctx, event, gitwatcher)
+}
+
+func (w *Gitea) handleEvent(ctx context.Context, event interface{}, receiver *webhookv1.GitWatcher) (int, error) {
+	execution := provider.NewGitCommit(receiver)
+	switch parsed := event.(type) {
+	case *github.CreateEvent:
+		if !receiver.Spec.Tag {
+			return http.StatusUnprocessableEntity, fmt.Errorf("tag watching is not currently turned on")
+		}
+		if parsed.GetRef() == "" {
+			return http.StatusUnprocessableEntity, errors.New("create event has empty tag ref")
+		}
+		if parsed.GetRefType() != "tag" {
+			return http.StatusUnprocessableEntity, errors.New("create event only supports tag type")
+		}
+		execution.Spec.Tag = parsed.GetRef()
+		err := git.TagMatch(receiver.Spec.TagIncludeRegexp, receiver.Spec.TagExcludeRegexp, execution.Spec.Tag)
+		if err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		setAuthor(execution, parsed.Sender)
+
+	case *github.PushEvent:
+		if strings.HasPrefix(parsed.GetRef(), "refs/heads/") {
+			execution.Spec.Branch = strings.TrimPrefix(parsed.GetRef(), "refs/heads/")
+		} else {
+			return http.StatusUnprocessableEntity, fmt.Errorf("push event only handles commits") // tag should be handled via create event
+		}
+		if err := git.BranchMatch(receiver.Spec.BranchInclude, receiver.Spec.BranchExclude, execution.Spec.Branch); err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		setAuthor(execution, parsed.Sender)
+
+		// Gitea has no API listing the files between two commits, so only those of the payload count
+		var files []string
+		for _, commit := range parsed.Commits {
+			files = append(files, commit.Added...)
+			files = append(files, commit.Modified...)
+			files = append(files, commit.Removed...)
+		}
+		if err := provider.MatchPaths(receiver, execution, files); err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+
+		// Gogs and older Gitea releases don't send head_commit
+		head := parsed.GetHeadCommit()
+		if head == nil && len(parsed.Commits) > 0 {
+			head = &parsed.Commits[len(parsed.Commits)-1]
+		}
+		execution.Spec.Commit = parsed.GetAfter()
+		if head != nil {
+			execution.Spec.Message = head.GetMessage()
+			execution.Spec.SourceLink = head.GetURL()
+			if execution.Spec.Commit == "" {
+				execution.Spec.Commit = head.GetID()
+			}
+		}
+
+	case *github.PullRequestEvent:
+		if !receiver.Spec.PR {
+			return http.StatusUnprocessableEntity, fmt.Errorf("pull request is not enabled")
+		}
+		action := parsed.GetAction()
+		if action == statusGiteaSynced {
+			action = statusSynced
+		}
+		if action != statusOpened && action != statusReopened && action != statusClosed && action != statusSynced {
+			return http.StatusUnprocessableEntity, fmt.Errorf("action %s ommitted", action)
+		}
+		execution.Spec.Action = action
+		setAuthor(execution, parsed.Sender)
+		execution.Spec.PR = strconv.Itoa(parsed.GetNumber())
+
+		if parsed.PullRequest != nil {
+			execution.Spec.Title = parsed.PullRequest.GetTitle()
+			execution.Spec.Message = parsed.PullRequest.GetBody()
+			execution.Spec.SourceLink = parsed.PullRequest.GetHTMLURL()
+			execution.Spec.Merged = parsed.PullRequest.GetMerged()
+			if parsed.PullRequest.Head != nil {
+				execution.Spec.Commit = parsed.PullRequest.Head.GetSHA()
+			}
+		}
+
+		if action == statusClosed {
+			execution.Spec.Closed = true
+		}
+
+		if parsed.Repo != nil {
+			execution.Spec.RepositoryURL = parsed.Repo.GetHTMLURL()
+		}
+
+	default:
+		return http.StatusUnprocessableEntity, fmt.Errorf("event %T is not supported", event)
+	}
+
+	if err := provider.CreateGitCommit(ctx, w.gitCommits, w.configMaps, w.recorder, receiver, execution); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+func setAuthor(execution *webhookv1.GitCommit, sender *github.User) {
+	if sender == nil {
+		return
+	}
+	execution.Spec.Author = sender.GetLogin()
+	execution.Spec.AuthorEmail = sender.GetEmail()
+	execution.Spec.AuthorAvatar = sender.GetAvatarURL()
+}
@@ -0,0 +1,198 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AppIDKey, InstallationIDKey and AppPrivateKeyKey are the keys of a webhook token secret
+	// authenticating as a GitHub App installation instead of with an accessToken
+	AppIDKey          = "appID"
+	InstallationIDKey = "installationID"
+	AppPrivateKeyKey  = "privateKey"
+
+	// GitHub rejects app JWTs valid for more than ten minutes
+	jwtLifetime = 9 * time.Minute
+	// installation tokens live for an hour, refresh them before they run out
+	tokenRefreshMargin = 5 * time.Minute
+	// installationTokenTimeout bounds requesting an installation token, which clients wait on
+	installationTokenTimeout = 30 * time.Second
+)
+
+var installationTokens = &tokenCache{
+	sources: map[string]cachedTokenSource{},
+}
+
+type tokenCache struct {
+	lock    sync.Mutex
+	sources map[string]cachedTokenSource
+}
+
+type cachedTokenSource struct {
+	resourceVersion string
+	httpClient      *http.Client
+	source          oauth2.TokenSource
+}
+
+func isApp(secret *corev1.Secret) bool {
+	return len(secret.Data[AppIDKey]) > 0
+}
+
+// tokenSource returns the credentials stored in secret, minting installation tokens for GitHub Apps.
+// Installation token sources are shared per secret and API endpoint until the secret changes, so tokens
+// are reused across clients.
+func tokenSource(httpClient *http.Client, apiURL, uploadURL string, secret *corev1.Secret) (oauth2.TokenSource, error) {
+	if !isApp(secret) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: string(secret.Data["accessToken"])}), nil
+	}
+
+	installationTokens.lock.Lock()
+	defer installationTokens.lock.Unlock()
+
+	key := secret.Namespace + "/" + secret.Name + "@" + apiURL
+	if cached, ok := installationTokens.sources[key]; ok && cached.resourceVersion == secret.ResourceVersion && cached.httpClient == httpClient {
+		return cached.source, nil
+	}
+
+	source, err := newAppTokenSource(httpClient, apiURL, uploadURL, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := cachedTokenSource{
+		resourceVersion: secret.ResourceVersion,
+		httpClient:      httpClient,
+		source:          oauth2.ReuseTokenSource(nil, source),
+	}
+	installationTokens.sources[key] = cached
+	return cached.source, nil
+}
+
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	httpClient     *http.Client
+	apiURL         string
+	uploadURL      string
+}
+
+func newAppTokenSource(httpClient *http.Client, apiURL, uploadURL string, secret *corev1.Secret) (*appTokenSource, error) {
+	appID, err := strconv.ParseInt(strings.TrimSpace(string(secret.Data[AppIDKey])), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in secret %s: %v", AppIDKey, secret.Name, err)
+	}
+
+	installationID, err := strconv.ParseInt(strings.TrimSpace(string(secret.Data[InstallationIDKey])), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in secret %s: %v", InstallationIDKey, secret.Name, err)
+	}
+
+	key, err := parsePrivateKey(secret.Data[AppPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in secret %s: %v", AppPrivateKeyKey, secret.Name, err)
+	}
+
+	return &appTokenSource{
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		httpClient:     httpClient,
+		apiURL:         apiURL,
+		uploadURL:      uploadURL,
+	}, nil
+}
+
+func (a *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), installationTokenTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, a.httpClient)
+	client, err := newClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwt})), a.apiURL, a.uploadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := client.Apps.CreateInstallationToken(ctx, a.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for app %d, error: %v", a.appID, err)
+	}
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt().Add(-tokenRefreshMargin),
+	}, nil
+}
+
+// jwt signs the RS256 token the app authenticates with when requesting installation tokens
+func (a *appTokenSource) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]int64{
+		// allow for clock drift between us and GitHub
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,69 @@
+package github
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTokenSourcePerEndpoint(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "github-app",
+			Namespace:       "default",
+			ResourceVersion: "1",
+		},
+		Data: map[string][]byte{
+			AppIDKey:          []byte("1"),
+			InstallationIDKey: []byte("2"),
+			AppPrivateKeyKey:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		},
+	}
+
+	newServer := func(token string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/2/access_tokens" {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"token": %q, "expires_at": "2099-01-01T00:00:00Z"}`, token)
+		}))
+	}
+	first, second := newServer("first-token"), newServer("second-token")
+	defer first.Close()
+	defer second.Close()
+
+	for _, test := range []struct {
+		server *httptest.Server
+		token  string
+	}{
+		{server: first, token: "first-token"},
+		{server: second, token: "second-token"},
+		{server: first, token: "first-token"},
+	} {
+		source, err := tokenSource(test.server.Client(), test.server.URL+"/api/v3/", test.server.URL+"/api/uploads/", secret)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		token, err := source.Token()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if token.AccessToken != test.token {
+			t.Errorf("expected token %s from %s, got %s", test.token, test.server.URL, token.AccessToken)
+		}
+	}
+}
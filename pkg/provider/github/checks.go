@@ -0,0 +1,196 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+)
+
+const (
+	// CheckRunName is the name of the check runs reporting GitCommits
+	CheckRunName = "gitwatcher"
+
+	checkRunInProgress = "in_progress"
+	checkRunCompleted  = "completed"
+
+	// GitHub takes at most this many annotations per request
+	maxAnnotations = 50
+)
+
+// checkRun is everything posted about a GitCommit, its hash tells whether the check run is up to date
+type checkRun struct {
+	Status     string                 `json:"status"`
+	Conclusion string                 `json:"conclusion,omitempty"`
+	DetailsURL string                 `json:"detailsUrl,omitempty"`
+	Output     *github.CheckRunOutput `json:"output"`
+}
+
+// SyncCheckRun creates or updates the check run reporting gitCommit. It returns gitCommit with the
+// check run recorded in its status, unchanged when the check run is up to date already.
+func SyncCheckRun(ctx context.Context, client *github.Client, gitWatcher *webhookv1.GitWatcher, gitCommit *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
+	run := newCheckRun(gitCommit)
+	if run == nil {
+		return gitCommit, nil
+	}
+
+	hash, err := run.hash()
+	if err != nil {
+		return gitCommit, err
+	}
+	if gitCommit.Status.CheckRun != nil && gitCommit.Status.CheckRun.Hash == hash {
+		return gitCommit, nil
+	}
+
+	owner, repo, err := GetOwnerAndRepo(gitWatcher.Spec.RepositoryURL)
+	if err != nil {
+		return gitCommit, err
+	}
+
+	var (
+		completedAt *github.Timestamp
+		conclusion  *string
+		detailsURL  *string
+	)
+	if run.Conclusion != "" {
+		completedAt = &github.Timestamp{Time: time.Now()}
+		conclusion = &run.Conclusion
+	}
+	if run.DetailsURL != "" {
+		detailsURL = &run.DetailsURL
+	}
+
+	output := run.Output
+	if !completes(gitCommit.Status.CheckRun, run) {
+		withoutAnnotations := *output
+		withoutAnnotations.Annotations = nil
+		output = &withoutAnnotations
+	}
+
+	var result *github.CheckRun
+	if gitCommit.Status.CheckRun == nil || gitCommit.Status.CheckRun.ID == 0 {
+		result, _, err = client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+			Name:        CheckRunName,
+			HeadBranch:  gitCommit.Spec.Branch,
+			HeadSHA:     gitCommit.Spec.Commit,
+			DetailsURL:  detailsURL,
+			ExternalID:  &gitCommit.Name,
+			Status:      &run.Status,
+			Conclusion:  conclusion,
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+	} else {
+		result, _, err = client.Checks.UpdateCheckRun(ctx, owner, repo, gitCommit.Status.CheckRun.ID, github.UpdateCheckRunOptions{
+			Name:        CheckRunName,
+			DetailsURL:  detailsURL,
+			Status:      &run.Status,
+			Conclusion:  conclusion,
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+	}
+	if err != nil {
+		return gitCommit, fmt.Errorf("failed to report check run for commit %s of %s/%s, error: %v", gitCommit.Spec.Commit, owner, repo, err)
+	}
+
+	gitCommit = gitCommit.DeepCopy()
+	gitCommit.Status.CheckRun = &webhookv1.CheckRunStatus{
+		ID:         result.GetID(),
+		Status:     run.Status,
+		Conclusion: run.Conclusion,
+		Hash:       hash,
+	}
+	return gitCommit, nil
+}
+
+// completes reports whether run is the update completing the check run reported as previous. GitHub
+// appends the annotations of every update, so they are only sent with that one.
+func completes(previous *webhookv1.CheckRunStatus, run *checkRun) bool {
+	return run.Status == checkRunCompleted && (previous == nil || previous.Status != checkRunCompleted)
+}
+
+// newCheckRun maps the state of gitCommit to a check run, which is in progress until the
+// GitCommit is handled. It returns nil while there's nothing to report.
+func newCheckRun(gitCommit *webhookv1.GitCommit) *checkRun {
+	run := &checkRun{
+		DetailsURL: gitCommit.Status.StatusURL,
+	}
+
+	state := CommitState(gitCommit)
+	switch state {
+	case "":
+		return nil
+	case statePending:
+		run.Status = checkRunInProgress
+	case stateSuccess:
+		run.Status = checkRunCompleted
+		run.Conclusion = stateSuccess
+	default:
+		run.Status = checkRunCompleted
+		run.Conclusion = stateFailure
+	}
+
+	// GitHub requires a title and summary with every output
+	title, summary := CheckRunName, webhookv1.GitWebHookExecutionConditionHandled.GetMessage(gitCommit)
+	if summary == "" {
+		summary = fmt.Sprintf("Commit %s is %s", gitCommit.Spec.Commit, state)
+	}
+	output := gitCommit.Status.CheckOutput
+	if output == nil {
+		output = &webhookv1.CheckOutput{}
+	}
+	if output.Title != "" {
+		title = output.Title
+	}
+	if output.Summary != "" {
+		summary = output.Summary
+	}
+
+	run.Output = &github.CheckRunOutput{
+		Title:   &title,
+		Summary: &summary,
+	}
+	if output.Text != "" {
+		run.Output.Text = github.String(output.Text)
+	}
+	for i, annotation := range output.Annotations {
+		if i == maxAnnotations {
+			break
+		}
+		level := annotation.Level
+		if level == "" {
+			level = "notice"
+		}
+		endLine := annotation.EndLine
+		if endLine < annotation.StartLine {
+			endLine = annotation.StartLine
+		}
+		checkAnnotation := &github.CheckRunAnnotation{
+			Path:            github.String(annotation.Path),
+			StartLine:       github.Int(annotation.StartLine),
+			EndLine:         github.Int(endLine),
+			AnnotationLevel: github.String(level),
+			Message:         github.String(annotation.Message),
+		}
+		if annotation.Title != "" {
+			checkAnnotation.Title = github.String(annotation.Title)
+		}
+		run.Output.Annotations = append(run.Output.Annotations, checkAnnotation)
+	}
+	return run
+}
+
+func (r *checkRun) hash() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
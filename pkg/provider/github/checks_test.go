@@ -0,0 +1,80 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+)
+
+func TestSyncCheckRunAnnotations(t *testing.T) {
+	var annotations []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Output *github.CheckRunOutput `json:"output"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		annotations = append(annotations, len(body.Output.Annotations))
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	gitWatcher := &webhookv1.GitWatcher{
+		Spec: webhookv1.GitWatcherSpec{
+			RepositoryURL: "https://github.com/owner/repo",
+		},
+	}
+	gitCommit := &webhookv1.GitCommit{
+		Spec: webhookv1.GitCommitSpec{
+			Commit: "abc",
+		},
+		Status: webhookv1.GitCommitStatus{
+			CheckOutput: &webhookv1.CheckOutput{
+				Annotations: []webhookv1.CheckAnnotation{
+					{Path: "main.go", StartLine: 1, Message: "unused variable"},
+				},
+			},
+		},
+	}
+
+	sync := func(update func(gitCommit *webhookv1.GitCommit)) {
+		update(gitCommit)
+		synced, err := SyncCheckRun(context.Background(), client, gitWatcher, gitCommit)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		gitCommit = synced
+	}
+	sync(func(gitCommit *webhookv1.GitCommit) {
+		webhookv1.GitWebHookExecutionConditionHandled.Unknown(gitCommit)
+	})
+	sync(func(gitCommit *webhookv1.GitCommit) {
+		gitCommit.Status.CheckOutput.Summary = "building"
+	})
+	sync(func(gitCommit *webhookv1.GitCommit) {
+		webhookv1.GitWebHookExecutionConditionHandled.True(gitCommit)
+	})
+	sync(func(gitCommit *webhookv1.GitCommit) {
+		gitCommit.Status.CheckOutput.Summary = "deployed"
+	})
+
+	expected := []int{0, 0, 1, 0}
+	if len(annotations) != len(expected) {
+		t.Fatalf("expected %d check run requests, got %d", len(expected), len(annotations))
+	}
+	for i := range expected {
+		if annotations[i] != expected[i] {
+			t.Errorf("expected request %d to send %d annotations, got %d", i, expected[i], annotations[i])
+		}
+	}
+}
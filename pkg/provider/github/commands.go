@@ -0,0 +1,111 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	commentCreated = "created"
+	// commandReaction acknowledges a comment once its command created a GitCommit
+	commandReaction = "+1"
+)
+
+var defaultAuthorAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// handleComment creates a GitCommit for the head of the pull request commented on when the comment
+// starts with one of the allowed slash commands, and reacts to the comment once it did
+func (w *GitHub) handleComment(ctx context.Context, client *github.Client, receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit, event *github.IssueCommentEvent) (int, error) {
+	commands := receiver.Spec.Commands
+	if commands == nil {
+		return http.StatusUnprocessableEntity, fmt.Errorf("comment commands are not enabled")
+	}
+	if event.GetAction() != commentCreated {
+		return http.StatusUnprocessableEntity, fmt.Errorf("action %s ommitted", event.GetAction())
+	}
+	if event.Issue == nil || !event.Issue.IsPullRequest() {
+		return http.StatusUnprocessableEntity, fmt.Errorf("issue %d is not a pull request", event.GetIssue().GetNumber())
+	}
+
+	command, args := parseCommand(event.GetComment().GetBody())
+	if command == "" {
+		return http.StatusUnprocessableEntity, fmt.Errorf("comment is not a command")
+	}
+	if !contains(commands.Allowed, command) {
+		return http.StatusUnprocessableEntity, fmt.Errorf("command %s is not allowed", command)
+	}
+	associations := commands.AuthorAssociations
+	if len(associations) == 0 {
+		associations = defaultAuthorAssociations
+	}
+	if association := event.GetComment().GetAuthorAssociation(); !contains(associations, association) {
+		return http.StatusUnprocessableEntity, fmt.Errorf("%s may not run commands as %s", event.GetComment().GetUser().GetLogin(), association)
+	}
+
+	owner, repo, err := GetOwnerAndRepo(receiver.Spec.RepositoryURL)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	number := event.GetIssue().GetNumber()
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to get pull request %d of %s/%s, error: %v", number, owner, repo, err)
+	}
+
+	execution.Spec.PR = strconv.Itoa(number)
+	execution.Spec.Commit = pr.GetHead().GetSHA()
+	execution.Spec.Branch = pr.GetHead().GetRef()
+	execution.Spec.Title = pr.GetTitle()
+	execution.Spec.Message = event.GetComment().GetBody()
+	execution.Spec.SourceLink = event.GetComment().GetHTMLURL()
+	execution.Spec.Command = command
+	execution.Spec.CommandArgs = args
+	if user := event.GetComment().GetUser(); user != nil {
+		execution.Spec.Author = safeString(user.Login)
+		execution.Spec.AuthorEmail = safeString(user.Email)
+		execution.Spec.AuthorAvatar = safeString(user.AvatarURL)
+	}
+	if event.Repo != nil {
+		execution.Spec.RepositoryURL = safeString(event.Repo.HTMLURL)
+	}
+
+	if err := provider.CreateGitCommit(ctx, w.gitCommits, w.configMaps, w.recorder, receiver, execution); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if _, _, err := client.Reactions.CreateIssueCommentReaction(ctx, owner, repo, event.GetComment().GetID(), commandReaction); err != nil {
+		logrus.Warnf("Failed to react to comment %d of %s/%s: %v", event.GetComment().GetID(), owner, repo, err)
+	}
+	return http.StatusOK, nil
+}
+
+// parseCommand returns the command, without its slash, and the arguments on the first line of body,
+// or an empty command when the comment doesn't start with a slash
+func parseCommand(body string) (string, []string) {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(body), "\n", 2)[0])
+	if !strings.HasPrefix(line, "/") {
+		return "", nil
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "/"))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
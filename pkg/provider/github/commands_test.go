@@ -0,0 +1,66 @@
+package github
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		command string
+		args    []string
+	}{
+		{
+			name:    "command",
+			body:    "/retest",
+			command: "retest",
+		},
+		{
+			name:    "command with arguments",
+			body:    "/deploy staging --force",
+			command: "deploy",
+			args:    []string{"staging", "--force"},
+		},
+		{
+			name:    "surrounding whitespace",
+			body:    "\n  /retest  \n",
+			command: "retest",
+		},
+		{
+			name:    "only the first line",
+			body:    "/deploy staging\nand then /retest",
+			command: "deploy",
+			args:    []string{"staging"},
+		},
+		{
+			name: "not a command",
+			body: "looks good, /retest please",
+		},
+		{
+			name: "command on a later line",
+			body: "looks good\n/retest",
+		},
+		{
+			name: "slash only",
+			body: "/",
+		},
+		{
+			name: "empty",
+			body: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command, args := parseCommand(test.body)
+			if command != test.command {
+				t.Errorf("expected command %q, got %q", test.command, command)
+			}
+			if len(args) != len(test.args) || (len(args) > 0 && !reflect.DeepEqual(args, test.args)) {
+				t.Errorf("expected arguments %q, got %q", test.args, args)
+			}
+		})
+	}
+}
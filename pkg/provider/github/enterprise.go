@@ -0,0 +1,99 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/metrics"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EnterpriseAPIURLKey and EnterpriseUploadURLKey are optional keys of the webhook token secret
+	// pointing the provider at a GitHub Enterprise Server instance
+	EnterpriseAPIURLKey    = "apiURL"
+	EnterpriseUploadURLKey = "uploadURL"
+
+	githubHost           = "github.com"
+	enterpriseAPIPath    = "/api/v3/"
+	enterpriseUploadPath = "/api/uploads/"
+)
+
+// NewClient returns a client for the GitHub instance obj watches, authenticated with either the
+// accessToken or the GitHub App installation stored in secret
+func NewClient(ctx context.Context, httpClient *http.Client, obj *webhookv1.GitWatcher, secret *corev1.Secret) (*github.Client, error) {
+	apiURL, uploadURL := enterpriseEndpoints(obj, secret)
+	ts, err := tokenSource(httpClient, apiURL, uploadURL, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	subCtx := context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	return newClient(instrument(oauth2.NewClient(subCtx, ts)), apiURL, uploadURL)
+}
+
+func newClient(httpClient *http.Client, apiURL, uploadURL string) (*github.Client, error) {
+	if apiURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+	return github.NewEnterpriseClient(apiURL, uploadURL, httpClient)
+}
+
+// instrument records latency and rate limit metrics for the API calls made with httpClient
+func instrument(httpClient *http.Client) *http.Client {
+	httpClient.Transport = metrics.GitHubTransport(httpClient.Transport)
+	return httpClient
+}
+
+// enterpriseEndpoints returns the API and upload URLs of the GitHub Enterprise Server obj watches,
+// or empty strings for github.com. URLs set in the secret win over GithubEnterpriseURL, which wins
+// over the host of a repository explicitly using the github provider.
+func enterpriseEndpoints(obj *webhookv1.GitWatcher, secret *corev1.Secret) (string, string) {
+	var apiURL, uploadURL string
+	if secret != nil {
+		apiURL = string(secret.Data[EnterpriseAPIURLKey])
+		uploadURL = string(secret.Data[EnterpriseUploadURLKey])
+	}
+
+	if apiURL == "" {
+		base := obj.Spec.GithubEnterpriseURL
+		if base == "" && strings.EqualFold(obj.Spec.Provider, "github") {
+			if u, err := url.Parse(obj.Spec.RepositoryURL); err == nil && u.Host != "" && u.Host != githubHost {
+				base = u.Scheme + "://" + u.Host
+			}
+		}
+		if base == "" {
+			return "", ""
+		}
+		apiURL = strings.TrimSuffix(base, "/") + enterpriseAPIPath
+	}
+
+	if uploadURL == "" {
+		uploadURL = strings.Replace(apiURL, enterpriseAPIPath, enterpriseUploadPath, 1)
+	}
+	return apiURL, uploadURL
+}
+
+// isEnterpriseRepository checks whether the repository obj watches is hosted on a configured
+// GitHub Enterprise Server
+func isEnterpriseRepository(obj *webhookv1.GitWatcher, secret *corev1.Secret) bool {
+	apiURL, _ := enterpriseEndpoints(obj, secret)
+	if apiURL == "" {
+		return false
+	}
+
+	api, err := url.Parse(apiURL)
+	if err != nil {
+		return false
+	}
+	repo, err := url.Parse(obj.Spec.RepositoryURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(api.Host, repo.Host)
+}
@@ -1,21 +1,23 @@
 package github
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v28/github"
 	"github.com/google/uuid"
 	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
 	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
 	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
 	"github.com/rancher/gitwatcher/pkg/provider/polling"
 	"github.com/rancher/gitwatcher/pkg/utils"
 	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
@@ -24,13 +26,18 @@ import (
 	"golang.org/x/oauth2"
 	errors2 "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
 	githubURL                   = "https://api.github.com"
-	HooksEndpointPrefix         = "hooks?gitwebhookId="
+	HooksEndpointPrefix         = provider.HooksEndpointPrefix
 	GitWebHookParam             = "gitwebhookId"
 	DeprecatedDefaultSecretName = "githubtoken"
+
+	// zeroCommit is the before commit of pushes creating a branch, and the after commit of pushes
+	// deleting one
+	zeroCommit = "0000000000000000000000000000000000000000"
 )
 
 const (
@@ -45,13 +52,17 @@ type GitHub struct {
 	gitWatchers v1.GitWatcherController
 	gitCommits  v1.GitCommitController
 	secretCache corev1controller.SecretCache
+	configMaps  corev1controller.ConfigMapController
+	recorder    record.EventRecorder
 	httpClient  *http.Client
 	apply       apply.Apply
 }
 
-func NewGitHub(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache) *GitHub {
+func NewGitHub(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *GitHub {
 	return &GitHub{
 		secretCache: secretCache,
+		configMaps:  configMaps,
+		recorder:    recorder,
 		gitCommits:  gitCommits,
 		gitWatchers: gitWatchers,
 		apply:       apply.WithStrictCaching(),
@@ -64,7 +75,7 @@ func (w *GitHub) Supports(obj *webhookv1.GitWatcher) bool {
 	if err != nil {
 		return false
 	}
-	_, err = w.secretCache.Get(obj.Namespace, secretName)
+	secret, err := w.secretCache.Get(obj.Namespace, secretName)
 	if errors2.IsNotFound(err) {
 		return false
 	}
@@ -77,6 +88,10 @@ func (w *GitHub) Supports(obj *webhookv1.GitWatcher) bool {
 		return true
 	}
 
+	if err == nil && isEnterpriseRepository(obj, secret) {
+		return true
+	}
+
 	return false
 }
 
@@ -98,6 +113,37 @@ func (w *GitHub) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhoo
 	return w.getFirstCommit(ctx, obj, githubClient)
 }
 
+func (w *GitHub) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	if obj.Status.HookID == "" {
+		return nil
+	}
+
+	hookID, err := strconv.ParseInt(obj.Status.HookID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	githubClient, err := w.getClient(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	owner, repo, err := GetOwnerAndRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := githubClient.Repositories.DeleteHook(ctx, owner, repo, hookID)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// already deleted on github
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete hook for %s/%s, error: %v", owner, repo, err)
+	}
+	return nil
+}
+
 func (w *GitHub) getFirstCommit(ctx context.Context, obj *webhookv1.GitWatcher, client *github.Client) (*webhookv1.GitWatcher, error) {
 	if obj.Status.FirstCommit != "" || obj.Spec.Branch == "" {
 		return obj, nil
@@ -149,7 +195,7 @@ func (w *GitHub) createHook(ctx context.Context, obj *webhookv1.GitWatcher, clie
 	hook, resp, err := client.Repositories.CreateHook(ctx, owner, repo, &github.Hook{
 		Events: events,
 		Config: map[string]interface{}{
-			"url":    getHookEndpoint(obj, obj.Spec.ReceiverURL),
+			"url":    provider.HookEndpoint(obj),
 			"secret": obj.Status.Token,
 		},
 	})
@@ -186,6 +232,14 @@ func getEvents(obj *webhookv1.GitWatcher) []string {
 	if obj.Spec.Tag {
 		events = append(events, "create")
 	}
+
+	if obj.Spec.GithubChecks {
+		events = append(events, "check_run")
+	}
+
+	if obj.Spec.Commands != nil {
+		events = append(events, "issue_comment")
+	}
 	return events
 }
 
@@ -199,10 +253,14 @@ func (w *GitHub) getClient(ctx context.Context, obj *webhookv1.GitWatcher) (*git
 		return nil, err
 	}
 
-	return NewGithubClient(ctx, w.httpClient, string(secret.Data["accessToken"])), nil
+	return NewClient(ctx, w.httpClient, obj, secret)
 }
 
 func (w *GitHub) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	if github.WebHookType(req) == "" {
+		return 0, nil
+	}
+
 	receiverID := req.URL.Query().Get(utils.GitWebHookParam)
 	if receiverID == "" {
 		return 0, nil
@@ -218,10 +276,29 @@ func (w *GitHub) HandleHook(ctx context.Context, req *http.Request) (int, error)
 		return http.StatusUnprocessableEntity, errors.New("webhook receiver is disabled")
 	}
 
-	payload, err := github.ValidatePayload(req, []byte(gitwatcher.Status.Token))
+	gitwatcher, err = provider.LoadTokens(w.secretCache, gitwatcher)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
+
+	tokens := provider.ValidTokens(gitwatcher, time.Now())
+	if provider.ValidationSkipped(ctx) {
+		tokens = nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	payload, err := validatePayload(req, body, tokens)
+	if err != nil {
+		provider.MarkValidationFailed(ctx)
+		return http.StatusUnauthorized, err
+	}
+	provider.MarkValidated(ctx)
+	if provider.ValidateOnly(ctx) {
+		return http.StatusAccepted, nil
+	}
+
 	event, err := github.ParseWebHook(github.WebHookType(req), payload)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -232,11 +309,35 @@ func (w *GitHub) HandleHook(ctx context.Context, req *http.Request) (int, error)
 		return http.StatusInternalServerError, err
 	}
 
+	ctx = provider.WithDelivery(ctx, provider.Delivery{
+		EventType: github.WebHookType(req),
+		ID:        github.DeliveryID(req),
+		Payload:   payload,
+	})
 	return w.handleEvent(ctx, client, event, gitwatcher)
 }
 
+// validatePayload accepts a delivery signed with any of tokens, so deliveries in flight while the
+// token is rotated still validate
+func validatePayload(req *http.Request, body []byte, tokens []string) ([]byte, error) {
+	if len(tokens) == 0 {
+		// go-github skips the signature check for an empty token, as it did before rotation
+		tokens = []string{""}
+	}
+
+	var err error
+	for _, token := range tokens {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var payload []byte
+		if payload, err = github.ValidatePayload(req, []byte(token)); err == nil {
+			return payload, nil
+		}
+	}
+	return nil, err
+}
+
 func (w *GitHub) handleEvent(ctx context.Context, client *github.Client, event interface{}, receiver *webhookv1.GitWatcher) (int, error) {
-	execution := initExecution(receiver)
+	execution := provider.NewGitCommit(receiver)
 	switch event.(type) {
 	case *github.CreateEvent:
 		if receiver.Spec.Tag == false {
@@ -268,6 +369,12 @@ func (w *GitHub) handleEvent(ctx context.Context, client *github.Client, event i
 			} else {
 				return http.StatusUnprocessableEntity, fmt.Errorf("push event only handles commits") // tag should be handled via create event
 			}
+			if err := git.BranchMatch(receiver.Spec.BranchInclude, receiver.Spec.BranchExclude, execution.Spec.Branch); err != nil {
+				return http.StatusUnprocessableEntity, err
+			}
+		}
+		if parsed.GetDeleted() || parsed.GetAfter() == zeroCommit {
+			return http.StatusUnprocessableEntity, errors.New("push event only handles created or updated branches")
 		}
 		if parsed.Sender != nil {
 			execution.Spec.Author = safeString(parsed.Sender.Login)
@@ -275,6 +382,16 @@ func (w *GitHub) handleEvent(ctx context.Context, client *github.Client, event i
 			execution.Spec.AuthorAvatar = safeString(parsed.Sender.AvatarURL)
 		}
 
+		if provider.FiltersPaths(receiver) {
+			files, err := pushedFiles(ctx, client, receiver, parsed)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			if err := provider.MatchPaths(receiver, execution, files); err != nil {
+				return http.StatusUnprocessableEntity, err
+			}
+		}
+
 		if parsed.GetHeadCommit() != nil {
 			execution.Spec.Message = safeString(parsed.GetHeadCommit().Message)
 			execution.Spec.Commit = safeString(parsed.GetHeadCommit().ID)
@@ -324,25 +441,95 @@ func (w *GitHub) handleEvent(ctx context.Context, client *github.Client, event i
 		if err := w.createDeploymentForPullRequest(ctx, client, receiver, execution, parsed); err != nil {
 			return http.StatusInternalServerError, err
 		}
+	case *github.CheckRunEvent:
+		if !receiver.Spec.GithubChecks {
+			return http.StatusUnprocessableEntity, fmt.Errorf("check runs are not enabled")
+		}
+		parsed := event.(*github.CheckRunEvent)
+		if parsed.GetAction() != provider.ActionRerequested {
+			return http.StatusUnprocessableEntity, fmt.Errorf("action %s ommitted", parsed.GetAction())
+		}
+		if parsed.GetCheckRun().GetName() != CheckRunName {
+			return http.StatusUnprocessableEntity, fmt.Errorf("check run %s is not reported by gitwatcher", parsed.GetCheckRun().GetName())
+		}
+		w.rerunCheckRun(receiver, execution, parsed)
+	case *github.IssueCommentEvent:
+		return w.handleComment(ctx, client, receiver, execution, event.(*github.IssueCommentEvent))
 	}
-	execution.OwnerReferences = append(execution.OwnerReferences, metav1.OwnerReference{
-		APIVersion: webhookv1.SchemeGroupVersion.String(),
-		Kind:       "GitWatcher",
-		Name:       receiver.Name,
-		UID:        receiver.UID,
-	})
-	_, err := w.gitCommits.Create(execution)
-	if err != nil {
+	if err := provider.CreateGitCommit(ctx, w.gitCommits, w.configMaps, w.recorder, receiver, execution); err != nil {
 		return http.StatusInternalServerError, err
 	}
 	return http.StatusOK, nil
 }
 
+// pushedFiles returns the files changed by a push. Push payloads list at most 20 commits without
+// telling whether some were left out, so the commits are compared through the API unless the push
+// created the branch and there is nothing to compare with.
+func pushedFiles(ctx context.Context, client *github.Client, receiver *webhookv1.GitWatcher, event *github.PushEvent) ([]string, error) {
+	var files []string
+	if event.GetCreated() || event.GetBefore() == "" || event.GetBefore() == zeroCommit {
+		for _, commit := range event.Commits {
+			files = append(files, commit.Added...)
+			files = append(files, commit.Modified...)
+			files = append(files, commit.Removed...)
+		}
+		return files, nil
+	}
+
+	owner, repo, err := GetOwnerAndRepo(receiver.Spec.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, repo, event.GetBefore(), event.GetAfter())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s...%s of %s/%s, error: %v", event.GetBefore(), event.GetAfter(), owner, repo, err)
+	}
+	for _, file := range comparison.Files {
+		files = append(files, file.GetFilename())
+		if file.GetPreviousFilename() != "" {
+			files = append(files, file.GetPreviousFilename())
+		}
+	}
+	return files, nil
+}
+
+// rerunCheckRun fills execution in from the GitCommit the rerequested check run reported, so the
+// commit is handled again the way it was the first time
+func (w *GitHub) rerunCheckRun(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit, event *github.CheckRunEvent) {
+	run := event.GetCheckRun()
+	execution.Spec.Commit = run.GetHeadSHA()
+	execution.Spec.Branch = run.GetCheckSuite().GetHeadBranch()
+	if len(run.PullRequests) > 0 {
+		execution.Spec.PR = strconv.Itoa(run.PullRequests[0].GetNumber())
+	}
+
+	if run.GetExternalID() != "" {
+		original, err := w.gitCommits.Get(receiver.Namespace, run.GetExternalID(), metav1.GetOptions{})
+		if err == nil && original.Spec.Commit == execution.Spec.Commit {
+			execution.Spec = *original.Spec.DeepCopy()
+			execution.Spec.Payload = ""
+			execution.Spec.PayloadConfigMapName = ""
+		}
+	}
+
+	execution.Spec.Action = provider.ActionRerequested
+	if event.Sender != nil {
+		execution.Spec.Author = safeString(event.Sender.Login)
+		execution.Spec.AuthorEmail = safeString(event.Sender.Email)
+		execution.Spec.AuthorAvatar = safeString(event.Sender.AvatarURL)
+	}
+}
+
 func (w *GitHub) createDeploymentForProduction(ctx context.Context, client *github.Client, gitWatcher *webhookv1.GitWatcher, gitCommit *webhookv1.GitCommit, commit string) error {
 	if !gitWatcher.Spec.GithubDeployment {
 		return nil
 	}
 
+	if recorded, err := provider.GitCommitRecorded(w.gitCommits, gitWatcher, gitCommit); err != nil || recorded {
+		// a redelivered event already has its deployment
+		return err
+	}
+
 	owner, repo, err := GetOwnerAndRepo(gitWatcher.Spec.RepositoryURL)
 	if err != nil {
 		return err
@@ -371,6 +558,11 @@ func (w *GitHub) createDeploymentForPullRequest(ctx context.Context, client *git
 		return nil
 	}
 
+	if recorded, err := provider.GitCommitRecorded(w.gitCommits, gitWatcher, gitCommit); err != nil || recorded {
+		// a redelivered event already has its deployment
+		return err
+	}
+
 	if *event.Action != statusOpened && *event.Action != statusSynced {
 		return nil
 	}
@@ -416,23 +608,13 @@ func (w *GitHub) createDeployment(ctx context.Context, client *github.Client, ow
 	return deploy, nil
 }
 
-func initExecution(receiver *webhookv1.GitWatcher) *webhookv1.GitCommit {
-	execution := &webhookv1.GitCommit{}
-	execution.GenerateName = receiver.Name + "-"
-	execution.Namespace = receiver.Namespace
-	execution.Spec.GitWatcherName = receiver.Name
-	execution.Labels = receiver.Spec.ExecutionLabels
-	execution.Spec.RepositoryURL = receiver.Spec.RepositoryURL
-	return execution
-}
-
 func NewGithubClient(ctx context.Context, httpClient *http.Client, token string) *github.Client {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
 	subCtx := context.WithValue(ctx, oauth2.HTTPClient, httpClient)
 
-	tc := oauth2.NewClient(subCtx, ts)
+	tc := instrument(oauth2.NewClient(subCtx, ts))
 
 	client := github.NewClient(tc)
 	return client
@@ -460,17 +642,6 @@ func GetOwnerAndRepo(repoURL string) (string, string, error) {
 	return owner, repo, nil
 }
 
-func getHookEndpoint(receiver *webhookv1.GitWatcher, endpoint string) string {
-	if os.Getenv("RIO_WEBHOOK_URL") != "" {
-		return hookURL(os.Getenv("RIO_WEBHOOK_URL"), receiver)
-	}
-	return hookURL(endpoint, receiver)
-}
-
-func hookURL(base string, receiver *webhookv1.GitWatcher) string {
-	return fmt.Sprintf("%s/%s%s:%s", base, HooksEndpointPrefix, receiver.Namespace, receiver.Name)
-}
-
 func safeString(s *string) string {
 	if s == nil {
 		return ""
@@ -0,0 +1,152 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPushedFiles(t *testing.T) {
+	payloadCommits := []github.PushEventCommit{
+		{Added: []string{"docs/README.md"}, Modified: []string{"main.go"}},
+		{Removed: []string{"old.go"}},
+	}
+
+	tests := []struct {
+		name     string
+		event    *github.PushEvent
+		compared bool
+		files    []string
+	}{
+		{
+			name: "push to an existing branch",
+			event: &github.PushEvent{
+				Before:  github.String("abc"),
+				After:   github.String("def"),
+				Commits: payloadCommits,
+			},
+			compared: true,
+			files:    []string{"pkg/new.go", "pkg/renamed.go", "pkg/original.go"},
+		},
+		{
+			name: "push creating a branch",
+			event: &github.PushEvent{
+				Before:  github.String(zeroCommit),
+				After:   github.String("def"),
+				Created: github.Bool(true),
+				Commits: payloadCommits,
+			},
+			files: []string{"docs/README.md", "main.go", "old.go"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compared := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/owner/repo/compare/abc...def" {
+					http.NotFound(w, r)
+					return
+				}
+				compared = true
+				fmt.Fprint(w, `{"files": [{"filename": "pkg/new.go"}, {"filename": "pkg/renamed.go", "previous_filename": "pkg/original.go"}]}`)
+			}))
+			defer server.Close()
+
+			client := github.NewClient(server.Client())
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+			receiver := &webhookv1.GitWatcher{
+				Spec: webhookv1.GitWatcherSpec{
+					RepositoryURL: "https://github.com/owner/repo",
+				},
+			}
+
+			files, err := pushedFiles(context.Background(), client, receiver, test.event)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if compared != test.compared {
+				t.Errorf("expected commits compared through the API: %v, got %v", test.compared, compared)
+			}
+			if !reflect.DeepEqual(files, test.files) {
+				t.Errorf("expected files %v, got %v", test.files, files)
+			}
+		})
+	}
+}
+
+func TestHandleDeletedPush(t *testing.T) {
+	receiver := &webhookv1.GitWatcher{
+		Spec: webhookv1.GitWatcherSpec{
+			RepositoryURL: "https://github.com/owner/repo",
+			Push:          true,
+			IncludePaths:  []string{"pkg"},
+		},
+	}
+	event := &github.PushEvent{
+		Ref:     github.String("refs/heads/feature"),
+		Before:  github.String("abc"),
+		After:   github.String(zeroCommit),
+		Deleted: github.Bool(true),
+	}
+
+	// a nil client fails the test should the deleted branch be compared
+	code, err := (&GitHub{}).handleEvent(context.Background(), nil, event, receiver)
+	if code != http.StatusUnprocessableEntity || err == nil {
+		t.Errorf("expected a deleted branch to be skipped with %d, got %d: %v", http.StatusUnprocessableEntity, code, err)
+	}
+}
+
+type fakeGitWatchers struct {
+	v1.GitWatcherController
+	gitWatcher *webhookv1.GitWatcher
+}
+
+func (f *fakeGitWatchers) Get(namespace, name string, options metav1.GetOptions) (*webhookv1.GitWatcher, error) {
+	return f.gitWatcher, nil
+}
+
+func TestHandleHookInvalidSignature(t *testing.T) {
+	gitWatcher := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watcher",
+			Namespace: "default",
+		},
+		Spec: webhookv1.GitWatcherSpec{
+			Enabled: true,
+		},
+		Status: webhookv1.GitWatcherStatus{
+			Token: "hook-token",
+		},
+	}
+	w := &GitHub{gitWatchers: &fakeGitWatchers{gitWatcher: gitWatcher}}
+
+	payload := `{"ref": "refs/heads/main"}`
+	mac := hmac.New(sha1.New, []byte("another-token"))
+	mac.Write([]byte(payload))
+
+	req := httptest.NewRequest(http.MethodPost, "/?"+utils.GitWebHookParam+"=default:watcher", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+
+	code, err := w.HandleHook(provider.WithValidation(context.Background()), req)
+	if code != http.StatusUnauthorized || err == nil {
+		t.Errorf("expected an invalid signature to be answered with %d, got %d: %v", http.StatusUnauthorized, code, err)
+	}
+}
@@ -0,0 +1,150 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/provider"
+)
+
+// Reconcile compares the hook registered on GitHub with the one obj asks for, edits it when the
+// events, url or active state drifted and recreates it when it was deleted on the repository
+func (w *GitHub) Reconcile(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.HookID == "" {
+		return obj, nil
+	}
+
+	hookID, err := strconv.ParseInt(obj.Status.HookID, 10, 64)
+	if err != nil {
+		return obj, err
+	}
+
+	githubClient, err := w.getClient(ctx, obj)
+	if err != nil {
+		return obj, err
+	}
+
+	owner, repo, err := GetOwnerAndRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	hook, resp, err := githubClient.Repositories.GetHook(ctx, owner, repo, hookID)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		obj = obj.DeepCopy()
+		obj.Status.HookID = ""
+		obj, err = w.createHook(ctx, obj, githubClient)
+		if err != nil {
+			return obj, err
+		}
+		webhookv1.GitWebHookReceiverConditionRegistered.True(obj)
+		webhookv1.GitWebHookReceiverConditionRegistered.Message(obj, fmt.Sprintf("hook %s was missing and has been recreated", obj.Status.HookID))
+		return obj, nil
+	}
+	if err != nil {
+		return obj, fmt.Errorf("failed to get hook for %s/%s, error: %v", owner, repo, err)
+	}
+
+	events := getEvents(obj)
+	if len(events) == 0 {
+		// github registers a hook without events for pushes only
+		events = []string{"push"}
+	}
+	endpoint := provider.HookEndpoint(obj)
+	if hook.GetActive() && hook.Config["url"] == endpoint && sameEvents(hook.Events, events) {
+		return obj, nil
+	}
+
+	if err := editHook(ctx, githubClient, owner, repo, hook, obj); err != nil {
+		return obj, err
+	}
+
+	obj = obj.DeepCopy()
+	webhookv1.GitWebHookReceiverConditionRegistered.True(obj)
+	webhookv1.GitWebHookReceiverConditionRegistered.Message(obj, fmt.Sprintf("hook %s drifted from the spec and has been updated", obj.Status.HookID))
+	return obj, nil
+}
+
+// RotateToken generates a new webhook token and sets it as the secret of the registered hook, the
+// previous token is still accepted for provider.TokenGracePeriod
+func (w *GitHub) RotateToken(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	rotated := provider.RotateToken(obj, time.Now())
+	if obj.Status.HookID == "" {
+		return rotated, nil
+	}
+
+	hookID, err := strconv.ParseInt(obj.Status.HookID, 10, 64)
+	if err != nil {
+		return obj, err
+	}
+
+	githubClient, err := w.getClient(ctx, obj)
+	if err != nil {
+		return obj, err
+	}
+
+	owner, repo, err := GetOwnerAndRepo(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	hook, _, err := githubClient.Repositories.GetHook(ctx, owner, repo, hookID)
+	if err != nil {
+		return obj, fmt.Errorf("failed to get hook for %s/%s, error: %v", owner, repo, err)
+	}
+
+	if err := editHook(ctx, githubClient, owner, repo, hook, rotated); err != nil {
+		return obj, err
+	}
+	return rotated, nil
+}
+
+// editHook sets the events, url and secret obj asks for on an existing hook
+func editHook(ctx context.Context, client *github.Client, owner, repo string, hook *github.Hook, obj *webhookv1.GitWatcher) error {
+	events := getEvents(obj)
+	if len(events) == 0 {
+		events = []string{"push"}
+	}
+
+	config := map[string]interface{}{
+		"url": provider.HookEndpoint(obj),
+		// github only returns a masked secret, send ours again so deliveries stay signed
+		"secret": obj.Status.Token,
+	}
+	if contentType, ok := hook.Config["content_type"]; ok {
+		config["content_type"] = contentType
+	}
+
+	active := true
+	_, _, err := client.Repositories.EditHook(ctx, owner, repo, hook.GetID(), &github.Hook{
+		Events: events,
+		Active: &active,
+		Config: config,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update hook for %s/%s, error: %v", owner, repo, err)
+	}
+	return nil
+}
+
+func sameEvents(actual, desired []string) bool {
+	if len(actual) != len(desired) {
+		return false
+	}
+	a := append([]string(nil), actual...)
+	d := append([]string(nil), desired...)
+	sort.Strings(a)
+	sort.Strings(d)
+	for i := range a {
+		if a[i] != d[i] {
+			return false
+		}
+	}
+	return true
+}
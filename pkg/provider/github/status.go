@@ -0,0 +1,77 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v28/github"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+)
+
+const (
+	// StatusContext is the context commit statuses are posted under
+	StatusContext = "gitwatcher"
+
+	statePending = "pending"
+	stateSuccess = "success"
+	stateFailure = "failure"
+	stateError   = "error"
+
+	// GitHub rejects commit status descriptions of more characters than this
+	maxDescriptionLength = 140
+)
+
+// CommitState maps the BuildStatus of gitCommit, or its Handled condition when no build status is
+// set, to the state of a commit status. It returns an empty string while there's nothing to report.
+func CommitState(gitCommit *webhookv1.GitCommit) string {
+	switch gitCommit.Status.BuildStatus {
+	case statePending, stateSuccess, stateFailure, stateError:
+		return gitCommit.Status.BuildStatus
+	case "queued", "in_progress":
+		return statePending
+	}
+
+	switch webhookv1.GitWebHookExecutionConditionHandled.GetStatus(gitCommit) {
+	case "True":
+		return stateSuccess
+	case "False":
+		return stateFailure
+	case "Unknown":
+		return statePending
+	}
+	return ""
+}
+
+// truncateDescription cuts description to the characters GitHub accepts, without splitting one
+func truncateDescription(description string) string {
+	runes := []rune(description)
+	if len(runes) <= maxDescriptionLength {
+		return description
+	}
+	return string(runes[:maxDescriptionLength-3]) + "..."
+}
+
+// CreateCommitStatus posts state as the status of the commit of gitCommit, linking to its StatusURL
+func CreateCommitStatus(ctx context.Context, client *github.Client, gitWatcher *webhookv1.GitWatcher, gitCommit *webhookv1.GitCommit, state string) error {
+	owner, repo, err := GetOwnerAndRepo(gitWatcher.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	status := &github.RepoStatus{
+		State:   &state,
+		Context: github.String(StatusContext),
+	}
+	if gitCommit.Status.StatusURL != "" {
+		status.TargetURL = &gitCommit.Status.StatusURL
+	}
+	if description := webhookv1.GitWebHookExecutionConditionHandled.GetMessage(gitCommit); description != "" {
+		description = truncateDescription(description)
+		status.Description = &description
+	}
+
+	if _, _, err := client.Repositories.CreateStatus(ctx, owner, repo, gitCommit.Spec.Commit, status); err != nil {
+		return fmt.Errorf("failed to create status for commit %s of %s/%s, error: %v", gitCommit.Spec.Commit, owner, repo, err)
+	}
+	return nil
+}
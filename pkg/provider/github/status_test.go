@@ -0,0 +1,115 @@
+package github
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestCommitState(t *testing.T) {
+	tests := []struct {
+		name        string
+		buildStatus string
+		handled     func(obj runtime.Object)
+		state       string
+	}{
+		{
+			name: "nothing to report",
+		},
+		{
+			name:    "handling",
+			handled: webhookv1.GitWebHookExecutionConditionHandled.Unknown,
+			state:   statePending,
+		},
+		{
+			name:    "handled",
+			handled: webhookv1.GitWebHookExecutionConditionHandled.True,
+			state:   stateSuccess,
+		},
+		{
+			name:    "handling failed",
+			handled: webhookv1.GitWebHookExecutionConditionHandled.False,
+			state:   stateFailure,
+		},
+		{
+			name:        "build status set",
+			buildStatus: stateError,
+			handled:     webhookv1.GitWebHookExecutionConditionHandled.True,
+			state:       stateError,
+		},
+		{
+			name:        "build queued",
+			buildStatus: "queued",
+			state:       statePending,
+		},
+		{
+			name:        "build in progress",
+			buildStatus: "in_progress",
+			handled:     webhookv1.GitWebHookExecutionConditionHandled.True,
+			state:       statePending,
+		},
+		{
+			name:        "unknown build status",
+			buildStatus: "skipped",
+			handled:     webhookv1.GitWebHookExecutionConditionHandled.False,
+			state:       stateFailure,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gitCommit := &webhookv1.GitCommit{}
+			gitCommit.Status.BuildStatus = test.buildStatus
+			if test.handled != nil {
+				test.handled(gitCommit)
+			}
+			if state := CommitState(gitCommit); state != test.state {
+				t.Errorf("expected state %q, got %q", test.state, state)
+			}
+		})
+	}
+}
+
+func TestTruncateDescription(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		expected    string
+	}{
+		{
+			name:        "short",
+			description: "deployed",
+			expected:    "deployed",
+		},
+		{
+			name:        "at the limit",
+			description: strings.Repeat("ü", maxDescriptionLength),
+			expected:    strings.Repeat("ü", maxDescriptionLength),
+		},
+		{
+			name:        "too long",
+			description: strings.Repeat("a", maxDescriptionLength+1),
+			expected:    strings.Repeat("a", maxDescriptionLength-3) + "...",
+		},
+		{
+			name:        "too long with multibyte characters",
+			description: strings.Repeat("ü", maxDescriptionLength+1),
+			expected:    strings.Repeat("ü", maxDescriptionLength-3) + "...",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			description := truncateDescription(test.description)
+			if description != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, description)
+			}
+			if !utf8.ValidString(description) {
+				t.Errorf("expected %q to be valid UTF-8", description)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rancher/gitwatcher/pkg/provider"
+)
+
+const (
+	apiPath = "/api/v4"
+)
+
+type Client struct {
+	api *provider.RESTClient
+}
+
+type Hook struct {
+	ID                    int    `json:"id,omitempty"`
+	URL                   string `json:"url"`
+	Token                 string `json:"token,omitempty"`
+	PushEvents            bool   `json:"push_events"`
+	TagPushEvents         bool   `json:"tag_push_events"`
+	MergeRequestsEvents   bool   `json:"merge_requests_events"`
+	EnableSSLVerification bool   `json:"enable_ssl_verification"`
+}
+
+type Branch struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+// Comparison lists the files changed between two commits
+type Comparison struct {
+	Diffs []struct {
+		OldPath string `json:"old_path"`
+		NewPath string `json:"new_path"`
+	} `json:"diffs"`
+}
+
+func NewClient(httpClient *http.Client, baseURL, token string) *Client {
+	return &Client{
+		api: provider.NewRESTClient(httpClient, baseURL, func(req *http.Request) {
+			req.Header.Set("PRIVATE-TOKEN", token)
+		}),
+	}
+}
+
+// APIURL derives the v4 API endpoint of the GitLab instance hosting repoURL
+func APIURL(repoURL string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("repository url %s is not an http(s) url", repoURL)
+	}
+	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, apiPath), nil
+}
+
+// ProjectPath returns the namespaced project path, including any subgroups, of repoURL
+func ProjectPath(repoURL string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", err
+	}
+	project := strings.Trim(u.Path, "/")
+	project = strings.TrimSuffix(project, ".git")
+	if !strings.Contains(project, "/") {
+		return "", fmt.Errorf("failed to find project path in %s", repoURL)
+	}
+	return project, nil
+}
+
+func (c *Client) CreateHook(ctx context.Context, project string, hook *Hook) (*Hook, error) {
+	result := &Hook{}
+	err := c.api.Do(ctx, http.MethodPost, projectURL(project, "hooks"), hook, result, http.StatusCreated)
+	return result, err
+}
+
+// DeleteHook removes a project hook, a hook that is already gone is not an error
+func (c *Client) DeleteHook(ctx context.Context, project, id string) error {
+	return c.api.Do(ctx, http.MethodDelete, projectURL(project, "hooks/"+url.PathEscape(id)), nil, nil, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
+
+func (c *Client) GetBranch(ctx context.Context, project, branch string) (*Branch, error) {
+	result := &Branch{}
+	err := c.api.Do(ctx, http.MethodGet, projectURL(project, "repository/branches/"+url.PathEscape(branch)), nil, result, http.StatusOK)
+	return result, err
+}
+
+func (c *Client) Compare(ctx context.Context, project, from, to string) (*Comparison, error) {
+	result := &Comparison{}
+	query := url.Values{"from": {from}, "to": {to}}
+	err := c.api.Do(ctx, http.MethodGet, projectURL(project, "repository/compare?"+query.Encode()), nil, result, http.StatusOK)
+	return result, err
+}
+
+func projectURL(project, path string) string {
+	return fmt.Sprintf("/projects/%s/%s", url.PathEscape(project), path)
+}
@@ -0,0 +1,74 @@
+package gitlab
+
+const (
+	eventPush         = "Push Hook"
+	eventTagPush      = "Tag Push Hook"
+	eventMergeRequest = "Merge Request Hook"
+)
+
+type project struct {
+	WebURL string `json:"web_url"`
+}
+
+type user struct {
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type commit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	URL      string   `json:"url"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// pushEvent is the payload of both Push Hook and Tag Push Hook deliveries
+type pushEvent struct {
+	Ref          string   `json:"ref"`
+	Before       string   `json:"before"`
+	After        string   `json:"after"`
+	CheckoutSHA  string   `json:"checkout_sha"`
+	UserName     string   `json:"user_name"`
+	UserUsername string   `json:"user_username"`
+	UserEmail    string   `json:"user_email"`
+	UserAvatar   string   `json:"user_avatar"`
+	Project      project  `json:"project"`
+	Commits      []commit `json:"commits"`
+	// TotalCommitsCount is larger than the number of Commits when GitLab left some out
+	TotalCommitsCount int `json:"total_commits_count"`
+}
+
+func (p *pushEvent) headCommit() *commit {
+	for i, c := range p.Commits {
+		if c.ID == p.CheckoutSHA {
+			return &p.Commits[i]
+		}
+	}
+	if len(p.Commits) > 0 {
+		return &p.Commits[len(p.Commits)-1]
+	}
+	return nil
+}
+
+type mergeRequest struct {
+	IID          int    `json:"iid"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	URL          string `json:"url"`
+	State        string `json:"state"`
+	Action       string `json:"action"`
+	OldRev       string `json:"oldrev"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+	LastCommit   commit `json:"last_commit"`
+}
+
+type mergeRequestEvent struct {
+	User             user         `json:"user"`
+	Project          project      `json:"project"`
+	ObjectAttributes mergeRequest `json:"object_attributes"`
+}
@@ -0,0 +1,407 @@
+package gitlab
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/provider"
+	"github.com/rancher/gitwatcher/pkg/provider/polling"
+	"github.com/rancher/gitwatcher/pkg/utils"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/apply"
+	"github.com/rancher/wrangler/pkg/kv"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	gitlabURL   = "https://gitlab.com"
+	eventHeader = "X-Gitlab-Event"
+	tokenHeader = "X-Gitlab-Token"
+	// eventUUIDHeader identifies a delivery on GitLab 14.7 and later
+	eventUUIDHeader = "X-Gitlab-Event-UUID"
+	// zeroCommit is the before commit of pushes creating a branch
+	zeroCommit = "0000000000000000000000000000000000000000"
+)
+
+const (
+	statusOpened   = "opened"
+	statusReopened = "reopened"
+	statusClosed   = "closed"
+	statusSynced   = "synchronize"
+)
+
+type GitLab struct {
+	gitWatchers v1.GitWatcherController
+	gitCommits  v1.GitCommitController
+	secretCache corev1controller.SecretCache
+	configMaps  corev1controller.ConfigMapController
+	recorder    record.EventRecorder
+	httpClient  *http.Client
+	apply       apply.Apply
+}
+
+func NewGitLab(apply apply.Apply, gitCommits v1.GitCommitController, gitWatchers v1.GitWatcherController, secretCache corev1controller.SecretCache, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder) *GitLab {
+	return &GitLab{
+		secretCache: secretCache,
+		configMaps:  configMaps,
+		recorder:    recorder,
+		gitCommits:  gitCommits,
+		gitWatchers: gitWatchers,
+		apply:       apply.WithStrictCaching(),
+		httpClient:  http.DefaultClient,
+	}
+}
+
+func (w *GitLab) Supports(obj *webhookv1.GitWatcher) bool {
+	if obj.Spec.GithubWebhookToken == "" {
+		return false
+	}
+	_, err := w.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if errors2.IsNotFound(err) {
+		return false
+	}
+
+	if strings.EqualFold(obj.Spec.Provider, "gitlab") {
+		return true
+	}
+
+	if strings.HasPrefix(obj.Spec.RepositoryURL, gitlabURL) {
+		return true
+	}
+
+	return false
+}
+
+func (w *GitLab) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.HookID != "" {
+		return obj, nil
+	}
+
+	client, err := w.getClient(obj)
+	if err != nil {
+		return obj, err
+	}
+
+	obj, err = w.createHook(ctx, obj, client)
+	if err != nil {
+		return obj, err
+	}
+
+	return w.getFirstCommit(ctx, obj, client)
+}
+
+func (w *GitLab) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	if obj.Status.HookID == "" {
+		return nil
+	}
+
+	client, err := w.getClient(obj)
+	if err != nil {
+		return err
+	}
+
+	project, err := ProjectPath(obj.Spec.RepositoryURL)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteHook(ctx, project, obj.Status.HookID); err != nil {
+		return fmt.Errorf("failed to delete hook for %s, error: %v", project, err)
+	}
+	return nil
+}
+
+func (w *GitLab) getFirstCommit(ctx context.Context, obj *webhookv1.GitWatcher, client *Client) (*webhookv1.GitWatcher, error) {
+	if obj.Status.FirstCommit != "" || obj.Spec.Branch == "" {
+		return obj, nil
+	}
+
+	project, err := ProjectPath(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	branch, err := client.GetBranch(ctx, project, obj.Spec.Branch)
+	if err != nil {
+		return obj, fmt.Errorf("failed to get branch for %s, error: %v", project, err)
+	}
+
+	if branch.Commit.ID == "" {
+		return obj, nil
+	}
+
+	err = polling.ApplyCommit(obj, branch.Commit.ID, w.apply)
+	obj = obj.DeepCopy()
+	obj.Status.FirstCommit = branch.Commit.ID
+	return obj, err
+}
+
+func (w *GitLab) createHook(ctx context.Context, obj *webhookv1.GitWatcher, client *Client) (*webhookv1.GitWatcher, error) {
+	obj = obj.DeepCopy()
+	obj.Status.Token = uuid.New().String()
+
+	project, err := ProjectPath(obj.Spec.RepositoryURL)
+	if err != nil {
+		return obj, err
+	}
+
+	hook, err := client.CreateHook(ctx, project, &Hook{
+		URL:                   provider.HookEndpoint(obj),
+		Token:                 obj.Status.Token,
+		PushEvents:            obj.Spec.Push,
+		TagPushEvents:         obj.Spec.Tag,
+		MergeRequestsEvents:   obj.Spec.PR,
+		EnableSSLVerification: true,
+	})
+	if err != nil {
+		return obj, fmt.Errorf("failed to create hook for %s, error: %v", project, err)
+	}
+
+	if hook.ID != 0 {
+		obj.Status.HookID = strconv.Itoa(hook.ID)
+	}
+
+	return obj, nil
+}
+
+func (w *GitLab) getClient(obj *webhookv1.GitWatcher) (*Client, error) {
+	if obj.Spec.GithubWebhookToken == "" {
+		return nil, errors.New("gitlab webhook token not found")
+	}
+	secret, err := w.secretCache.Get(obj.Namespace, obj.Spec.GithubWebhookToken)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, err := APIURL(obj.Spec.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(w.httpClient, baseURL, string(secret.Data["accessToken"])), nil
+}
+
+func (w *GitLab) HandleHook(ctx context.Context, req *http.Request) (int, error) {
+	eventType := req.Header.Get(eventHeader)
+	if eventType == "" {
+		return 0, nil
+	}
+
+	receiverID := req.URL.Query().Get(utils.GitWebHookParam)
+	if receiverID == "" {
+		return 0, nil
+	}
+
+	ns, name := kv.Split(receiverID, ":")
+	gitwatcher, err := w.gitWatchers.Get(ns, name, metav1.GetOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !gitwatcher.Spec.Enabled {
+		return http.StatusUnprocessableEntity, errors.New("webhook receiver is disabled")
+	}
+
+	gitwatcher, err = provider.LoadTokens(w.secretCache, gitwatcher)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	provider.MarkCredentialHeader(ctx, tokenHeader)
+	err = provider.Validate(ctx, func() error {
+		if gitwatcher.Status.Token == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get(tokenHeader)), []byte(gitwatcher.Status.Token)) != 1 {
+			return errors.New("invalid gitlab webhook token")
+		}
+		return nil
+	})
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if provider.ValidateOnly(ctx) {
+		return http.StatusAccepted, nil
+	}
+
+	payload, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	ctx = provider.WithDelivery(ctx, provider.Delivery{
+		EventType: eventType,
+		ID:        req.Header.Get(eventUUIDHeader),
+		Payload:   payload,
+	})
+	return w.handleEvent(ctx, eventType, payload, gitwatcher)
+}
+
+func (w *GitLab) handleEvent(ctx context.Context, eventType string, payload []byte, receiver *webhookv1.GitWatcher) (int, error) {
+	execution := provider.NewGitCommit(receiver)
+	switch eventType {
+	case eventTagPush:
+		if !receiver.Spec.Tag {
+			return http.StatusUnprocessableEntity, fmt.Errorf("tag watching is not currently turned on")
+		}
+		parsed := &pushEvent{}
+		if err := json.Unmarshal(payload, parsed); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if !strings.HasPrefix(parsed.Ref, "refs/tags/") {
+			return http.StatusUnprocessableEntity, errors.New("tag push event has empty tag ref")
+		}
+		if parsed.CheckoutSHA == "" {
+			return http.StatusUnprocessableEntity, errors.New("tag push event only handles created tags")
+		}
+		execution.Spec.Tag = strings.TrimPrefix(parsed.Ref, "refs/tags/")
+		err := git.TagMatch(receiver.Spec.TagIncludeRegexp, receiver.Spec.TagExcludeRegexp, execution.Spec.Tag)
+		if err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		execution.Spec.Commit = parsed.CheckoutSHA
+		setPushAuthor(execution, parsed)
+
+	case eventPush:
+		parsed := &pushEvent{}
+		if err := json.Unmarshal(payload, parsed); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if strings.HasPrefix(parsed.Ref, "refs/heads/") {
+			execution.Spec.Branch = strings.TrimPrefix(parsed.Ref, "refs/heads/")
+		} else {
+			return http.StatusUnprocessableEntity, fmt.Errorf("push event only handles commits") // tag should be handled via tag push event
+		}
+		if err := git.BranchMatch(receiver.Spec.BranchInclude, receiver.Spec.BranchExclude, execution.Spec.Branch); err != nil {
+			return http.StatusUnprocessableEntity, err
+		}
+		setPushAuthor(execution, parsed)
+
+		if provider.FiltersPaths(receiver) {
+			files, err := w.pushedFiles(ctx, receiver, parsed)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			if err := provider.MatchPaths(receiver, execution, files); err != nil {
+				return http.StatusUnprocessableEntity, err
+			}
+		}
+
+		execution.Spec.Commit = parsed.CheckoutSHA
+		if head := parsed.headCommit(); head != nil {
+			execution.Spec.Message = head.Message
+			execution.Spec.SourceLink = head.URL
+			if execution.Spec.Commit == "" {
+				execution.Spec.Commit = head.ID
+			}
+		}
+
+	case eventMergeRequest:
+		if !receiver.Spec.PR {
+			return http.StatusUnprocessableEntity, fmt.Errorf("pull request is not enabled")
+		}
+		parsed := &mergeRequestEvent{}
+		if err := json.Unmarshal(payload, parsed); err != nil {
+			return http.StatusBadRequest, err
+		}
+		mr := parsed.ObjectAttributes
+		action, merged, ok := pullRequestAction(mr)
+		if !ok {
+			return http.StatusUnprocessableEntity, fmt.Errorf("action %s ommitted", mr.Action)
+		}
+		execution.Spec.Action = action
+		execution.Spec.Author = parsed.User.Username
+		execution.Spec.AuthorEmail = parsed.User.Email
+		execution.Spec.AuthorAvatar = parsed.User.AvatarURL
+		execution.Spec.PR = strconv.Itoa(mr.IID)
+		execution.Spec.Title = mr.Title
+		execution.Spec.Message = mr.Description
+		execution.Spec.SourceLink = mr.URL
+		execution.Spec.Merged = merged
+		execution.Spec.Commit = mr.LastCommit.ID
+
+		if action == statusClosed {
+			execution.Spec.Closed = true
+		}
+
+		if parsed.Project.WebURL != "" {
+			execution.Spec.RepositoryURL = parsed.Project.WebURL
+		}
+
+	default:
+		return http.StatusUnprocessableEntity, fmt.Errorf("event %s is not supported", eventType)
+	}
+
+	if err := provider.CreateGitCommit(ctx, w.gitCommits, w.configMaps, w.recorder, receiver, execution); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// pushedFiles returns the files changed by a push, comparing its commits through the API when the
+// payload only lists some of them
+func (w *GitLab) pushedFiles(ctx context.Context, receiver *webhookv1.GitWatcher, event *pushEvent) ([]string, error) {
+	var files []string
+	if event.TotalCommitsCount <= len(event.Commits) || event.Before == zeroCommit {
+		for _, commit := range event.Commits {
+			files = append(files, commit.Added...)
+			files = append(files, commit.Modified...)
+			files = append(files, commit.Removed...)
+		}
+		return files, nil
+	}
+
+	client, err := w.getClient(receiver)
+	if err != nil {
+		return nil, err
+	}
+	project, err := ProjectPath(receiver.Spec.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	comparison, err := client.Compare(ctx, project, event.Before, event.After)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s...%s of %s, error: %v", event.Before, event.After, project, err)
+	}
+	for _, diff := range comparison.Diffs {
+		files = append(files, diff.OldPath, diff.NewPath)
+	}
+	return files, nil
+}
+
+// pullRequestAction maps a merge request action onto the pull request actions GitHub reports,
+// a merge is reported as a closed action on a merged pull request
+func pullRequestAction(mr mergeRequest) (string, bool, bool) {
+	switch mr.Action {
+	case "open":
+		return statusOpened, false, true
+	case "reopen":
+		return statusReopened, false, true
+	case "close":
+		return statusClosed, false, true
+	case "merge":
+		return statusClosed, true, true
+	case "update":
+		// updates without a previous revision are title, label or assignee changes
+		if mr.OldRev != "" {
+			return statusSynced, false, true
+		}
+	}
+	return "", false, false
+}
+
+func setPushAuthor(execution *webhookv1.GitCommit, event *pushEvent) {
+	execution.Spec.Author = event.UserUsername
+	execution.Spec.AuthorEmail = event.UserEmail
+	execution.Spec.AuthorAvatar = event.UserAvatar
+}
@@ -0,0 +1,318 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	testAccessToken = "access-token"
+	testHookToken   = "hook-token"
+)
+
+type fakeSecrets struct {
+	corev1controller.SecretCache
+	secrets map[string]*corev1.Secret
+}
+
+func (f *fakeSecrets) Get(namespace, name string) (*corev1.Secret, error) {
+	if secret, ok := f.secrets[namespace+"/"+name]; ok {
+		return secret, nil
+	}
+	return nil, errors.NewNotFound(corev1.Resource("secrets"), name)
+}
+
+type fakeGitWatchers struct {
+	v1.GitWatcherController
+	gitWatcher *webhookv1.GitWatcher
+}
+
+func (f *fakeGitWatchers) Get(namespace, name string, options metav1.GetOptions) (*webhookv1.GitWatcher, error) {
+	if f.gitWatcher.Namespace == namespace && f.gitWatcher.Name == name {
+		return f.gitWatcher, nil
+	}
+	return nil, errors.NewNotFound(webhookv1.Resource("gitwatchers"), name)
+}
+
+type fakeGitCommits struct {
+	v1.GitCommitController
+	created []*webhookv1.GitCommit
+}
+
+func (f *fakeGitCommits) Create(obj *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
+	for _, existing := range f.created {
+		if existing.Name == obj.Name {
+			return nil, errors.NewAlreadyExists(webhookv1.Resource("gitcommits"), obj.Name)
+		}
+	}
+	obj = obj.DeepCopy()
+	f.created = append(f.created, obj)
+	return obj, nil
+}
+
+func (f *fakeGitCommits) Get(namespace, name string, options metav1.GetOptions) (*webhookv1.GitCommit, error) {
+	for _, existing := range f.created {
+		if existing.Namespace == namespace && existing.Name == name {
+			return existing, nil
+		}
+	}
+	return nil, errors.NewNotFound(webhookv1.Resource("gitcommits"), name)
+}
+
+// newTestGitLab returns a provider talking to server, with a GitWatcher for the project group/project on it
+func newTestGitLab(server *httptest.Server, spec webhookv1.GitWatcherSpec) (*GitLab, *fakeGitCommits, *webhookv1.GitWatcher) {
+	spec.Provider = "gitlab"
+	spec.Enabled = true
+	spec.RepositoryURL = server.URL + "/group/project.git"
+	spec.ReceiverURL = "https://gitwatcher.example.com"
+	spec.GithubWebhookToken = "gitlab-credentials"
+	gitWatcher := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watcher",
+			Namespace: "default",
+			UID:       "uid",
+		},
+		Spec: spec,
+		Status: webhookv1.GitWatcherStatus{
+			Token: testHookToken,
+		},
+	}
+
+	gitCommits := &fakeGitCommits{}
+	return &GitLab{
+		gitWatchers: &fakeGitWatchers{gitWatcher: gitWatcher},
+		gitCommits:  gitCommits,
+		secretCache: &fakeSecrets{
+			secrets: map[string]*corev1.Secret{
+				"default/gitlab-credentials": {
+					Data: map[string][]byte{"accessToken": []byte(testAccessToken)},
+				},
+			},
+		},
+		recorder:   record.NewFakeRecorder(100),
+		httpClient: server.Client(),
+	}, gitCommits, gitWatcher
+}
+
+func TestCreateHook(t *testing.T) {
+	var posted Hook
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.EscapedPath() != "/api/v4/projects/group%2Fproject/hooks" {
+			t.Errorf("unexpected request %s %s", req.Method, req.URL.EscapedPath())
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if token := req.Header.Get("PRIVATE-TOKEN"); token != testAccessToken {
+			t.Errorf("expected access token %q, got %q", testAccessToken, token)
+		}
+		if err := json.NewDecoder(req.Body).Decode(&posted); err != nil {
+			t.Error(err)
+		}
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(`{"id": 42}`))
+	}))
+	defer server.Close()
+
+	w, _, gitWatcher := newTestGitLab(server, webhookv1.GitWatcherSpec{
+		Push: true,
+		PR:   true,
+	})
+	gitWatcher.Status.Token = ""
+
+	result, err := w.Create(context.Background(), gitWatcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status.HookID != "42" {
+		t.Errorf("expected hook id 42, got %q", result.Status.HookID)
+	}
+	if result.Status.Token == "" || posted.Token != result.Status.Token {
+		t.Errorf("expected the hook to be created with token %q, got %q", result.Status.Token, posted.Token)
+	}
+	if expected := "https://gitwatcher.example.com/hooks?gitwebhookId=default:watcher"; posted.URL != expected {
+		t.Errorf("expected hook url %q, got %q", expected, posted.URL)
+	}
+	if !posted.PushEvents || !posted.MergeRequestsEvents || posted.TagPushEvents {
+		t.Errorf("expected push and merge request events only, got %+v", posted)
+	}
+	if !posted.EnableSSLVerification {
+		t.Error("expected ssl verification to be enabled")
+	}
+}
+
+func TestHandleHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.EscapedPath() != "/api/v4/projects/group%2Fproject/repository/compare" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(`{"diffs": [{"old_path": "services/api/main.go", "new_path": "services/api/main.go"}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		spec      webhookv1.GitWatcherSpec
+		event     string
+		token     string
+		payload   string
+		code      int
+		gitCommit *webhookv1.GitCommitSpec
+	}{
+		{
+			name:    "push",
+			spec:    webhookv1.GitWatcherSpec{Push: true},
+			event:   eventPush,
+			token:   testHookToken,
+			payload: `{"ref": "refs/heads/main", "checkout_sha": "abc123", "user_username": "alice", "commits": [{"id": "abc123", "message": "fix", "url": "https://example.com/abc123"}]}`,
+			code:    http.StatusOK,
+			gitCommit: &webhookv1.GitCommitSpec{
+				Branch:     "main",
+				Commit:     "abc123",
+				Message:    "fix",
+				SourceLink: "https://example.com/abc123",
+				Author:     "alice",
+			},
+		},
+		{
+			name:    "invalid token",
+			spec:    webhookv1.GitWatcherSpec{Push: true},
+			event:   eventPush,
+			token:   "wrong",
+			payload: `{"ref": "refs/heads/main", "checkout_sha": "abc123"}`,
+			code:    http.StatusUnauthorized,
+		},
+		{
+			name:    "tag push without tag watching",
+			spec:    webhookv1.GitWatcherSpec{Push: true},
+			event:   eventTagPush,
+			token:   testHookToken,
+			payload: `{"ref": "refs/tags/v1.0.0", "checkout_sha": "abc123"}`,
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "tag push",
+			spec:    webhookv1.GitWatcherSpec{Tag: true},
+			event:   eventTagPush,
+			token:   testHookToken,
+			payload: `{"ref": "refs/tags/v1.0.0", "checkout_sha": "abc123"}`,
+			code:    http.StatusOK,
+			gitCommit: &webhookv1.GitCommitSpec{
+				Tag:    "v1.0.0",
+				Commit: "abc123",
+			},
+		},
+		{
+			name:    "excluded branch",
+			spec:    webhookv1.GitWatcherSpec{Push: true, BranchExclude: []string{"feature/*"}},
+			event:   eventPush,
+			token:   testHookToken,
+			payload: `{"ref": "refs/heads/feature/x", "checkout_sha": "abc123"}`,
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "merge request",
+			spec:    webhookv1.GitWatcherSpec{PR: true},
+			event:   eventMergeRequest,
+			token:   testHookToken,
+			payload: `{"user": {"username": "bob"}, "object_attributes": {"iid": 7, "title": "feature", "action": "open", "last_commit": {"id": "def456"}}}`,
+			code:    http.StatusOK,
+			gitCommit: &webhookv1.GitCommitSpec{
+				PR:     "7",
+				Action: statusOpened,
+				Commit: "def456",
+				Title:  "feature",
+				Author: "bob",
+			},
+		},
+		{
+			name:    "merge request label change",
+			spec:    webhookv1.GitWatcherSpec{PR: true},
+			event:   eventMergeRequest,
+			token:   testHookToken,
+			payload: `{"object_attributes": {"iid": 7, "action": "update", "last_commit": {"id": "def456"}}}`,
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "unmatched paths",
+			spec:    webhookv1.GitWatcherSpec{Push: true, IncludePaths: []string{"services/api/**"}},
+			event:   eventPush,
+			token:   testHookToken,
+			payload: `{"ref": "refs/heads/main", "before": "000111", "after": "abc123", "checkout_sha": "abc123", "total_commits_count": 1, "commits": [{"id": "abc123", "modified": ["docs/README.md"]}]}`,
+			code:    http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "paths of truncated push",
+			spec:    webhookv1.GitWatcherSpec{Push: true, IncludePaths: []string{"services/api/**"}},
+			event:   eventPush,
+			token:   testHookToken,
+			payload: `{"ref": "refs/heads/main", "before": "000111", "after": "abc123", "checkout_sha": "abc123", "total_commits_count": 30, "commits": [{"id": "abc123", "modified": ["docs/README.md"]}]}`,
+			code:    http.StatusOK,
+			gitCommit: &webhookv1.GitCommitSpec{
+				Branch:       "main",
+				Commit:       "abc123",
+				ChangedFiles: []string{"services/api/main.go"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, gitCommits, _ := newTestGitLab(server, test.spec)
+
+			req := httptest.NewRequest(http.MethodPost, "/hooks?gitwebhookId=default:watcher", strings.NewReader(test.payload))
+			req.Header.Set(eventHeader, test.event)
+			req.Header.Set(tokenHeader, test.token)
+			req.Header.Set(eventUUIDHeader, "delivery-1")
+
+			code, err := w.HandleHook(context.Background(), req)
+			if code != test.code {
+				t.Fatalf("expected code %d, got %d, error: %v", test.code, code, err)
+			}
+
+			if test.gitCommit == nil {
+				if len(gitCommits.created) != 0 {
+					t.Fatalf("expected no GitCommit, got %d", len(gitCommits.created))
+				}
+				return
+			}
+			if len(gitCommits.created) != 1 {
+				t.Fatalf("expected one GitCommit, got %d", len(gitCommits.created))
+			}
+
+			spec := gitCommits.created[0].Spec
+			if spec.EventType != test.event || spec.DeliveryID != "delivery-1" || spec.GitWatcherName != "watcher" {
+				t.Errorf("expected delivery %s of %s for watcher, got %s of %s for %s", "delivery-1", test.event, spec.DeliveryID, spec.EventType, spec.GitWatcherName)
+			}
+			got := webhookv1.GitCommitSpec{
+				Branch:       spec.Branch,
+				Tag:          spec.Tag,
+				PR:           spec.PR,
+				Action:       spec.Action,
+				Commit:       spec.Commit,
+				Title:        spec.Title,
+				Message:      spec.Message,
+				SourceLink:   spec.SourceLink,
+				Author:       spec.Author,
+				ChangedFiles: spec.ChangedFiles,
+			}
+			gotJSON, _ := json.Marshal(got)
+			expectedJSON, _ := json.Marshal(test.gitCommit)
+			if string(gotJSON) != string(expectedJSON) {
+				t.Errorf("expected GitCommit %s, got %s", expectedJSON, gotJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/metrics"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/name"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	HooksEndpointPrefix = "hooks?gitwebhookId="
+
+	// ActionRerequested is the action of a GitCommit created to run a commit again, every such
+	// request gets a GitCommit of its own
+	ActionRerequested = "rerequested"
+
+	// gitCommitHashLength is the number of hex characters of the event key GitCommits are named with
+	gitCommitHashLength = 10
+	// legacyGitCommitHashLength is the shorter hash GitCommits were named with by earlier releases
+	legacyGitCommitHashLength = 5
+)
+
+// NewGitCommit returns a GitCommit owned by receiver with the fields
+// every provider sets before filling in the event details
+func NewGitCommit(receiver *webhookv1.GitWatcher) *webhookv1.GitCommit {
+	execution := &webhookv1.GitCommit{}
+	execution.GenerateName = receiver.Name + "-"
+	execution.Namespace = receiver.Namespace
+	execution.Spec.GitWatcherName = receiver.Name
+	execution.Labels = receiver.Spec.ExecutionLabels
+	execution.Spec.RepositoryURL = receiver.Spec.RepositoryURL
+	execution.OwnerReferences = append(execution.OwnerReferences, metav1.OwnerReference{
+		APIVersion: webhookv1.SchemeGroupVersion.String(),
+		Kind:       "GitWatcher",
+		Name:       receiver.Name,
+		UID:        receiver.UID,
+	})
+	return execution
+}
+
+// GitCommitName derives the name of the GitCommit recording execution from the event it describes, so
+// every delivery of the same event maps to the same name. A push to the watched branch is named like
+// the commits polling creates for that branch.
+func GitCommitName(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit) string {
+	return gitCommitName(receiver, execution, gitCommitHashLength)
+}
+
+// LegacyGitCommitName is the name earlier releases gave the GitCommit recording execution, polling
+// looks it up so upgrading doesn't create a second GitCommit for the head of the watched branch
+func LegacyGitCommitName(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit) string {
+	return gitCommitName(receiver, execution, legacyGitCommitHashLength)
+}
+
+func gitCommitName(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit, hashLength int) string {
+	key := execution.Spec.Commit
+	switch {
+	case execution.Spec.Action == ActionRerequested:
+		key = strings.Join([]string{"rerun", execution.Spec.DeliveryID, execution.Spec.Commit}, "/")
+	case execution.Spec.Command != "":
+		key = strings.Join([]string{"command", execution.Spec.DeliveryID, execution.Spec.Command, execution.Spec.Commit}, "/")
+	case execution.Spec.PR != "":
+		key = strings.Join([]string{"pr", execution.Spec.PR, execution.Spec.Action, execution.Spec.Commit}, "/")
+	case execution.Spec.Tag != "":
+		key = strings.Join([]string{"tag", execution.Spec.Tag, execution.Spec.Commit}, "/")
+	case execution.Spec.Branch != receiver.Spec.Branch:
+		key = strings.Join([]string{"branch", execution.Spec.Branch, execution.Spec.Commit}, "/")
+	}
+	return name.SafeConcatName(receiver.Name, name.Hex(key, hashLength))
+}
+
+// CreateGitCommit creates execution under its GitCommitName, recording the delivery attached to ctx.
+// A redelivered event finds its GitCommit already there and succeeds without creating a duplicate,
+// a different event whose name collides falls back to a generated name.
+func CreateGitCommit(ctx context.Context, gitCommits v1.GitCommitController, configMaps corev1controller.ConfigMapController, recorder record.EventRecorder, receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit) error {
+	payload := recordDelivery(ctx, execution)
+	execution.Name = GitCommitName(receiver, execution)
+	created, err := gitCommits.Create(execution)
+	if errors.IsAlreadyExists(err) {
+		existing, getErr := gitCommits.Get(execution.Namespace, execution.Name, metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		if sameEvent(existing, execution) {
+			return nil
+		}
+
+		execution.Name = ""
+		created, err = gitCommits.Create(execution)
+	}
+	if err != nil {
+		return err
+	}
+
+	source := "webhook"
+	if execution.Spec.EventType != "" {
+		source = execution.Spec.EventType
+	}
+	metrics.GitCommitsCreated.WithLabelValues(source).Inc()
+	RecordGitCommit(recorder, receiver, created)
+	if payload == nil {
+		return nil
+	}
+
+	return storePayload(gitCommits, configMaps, created, payload)
+}
+
+// GitCommitRecorded reports whether the event execution describes already has a GitCommit, letting
+// providers skip side effects such as deployments on a redelivery
+func GitCommitRecorded(gitCommits v1.GitCommitController, receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit) (bool, error) {
+	existing, err := gitCommits.Get(execution.Namespace, GitCommitName(receiver, execution), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return sameEvent(existing, execution), nil
+}
+
+func sameEvent(a, b *webhookv1.GitCommit) bool {
+	return a.Spec.Commit == b.Spec.Commit &&
+		a.Spec.Branch == b.Spec.Branch &&
+		a.Spec.Tag == b.Spec.Tag &&
+		a.Spec.PR == b.Spec.PR &&
+		a.Spec.Action == b.Spec.Action &&
+		a.Spec.Command == b.Spec.Command
+}
+
+// HookEndpoint is the URL a remote repository should deliver events for receiver to
+func HookEndpoint(receiver *webhookv1.GitWatcher) string {
+	if os.Getenv("RIO_WEBHOOK_URL") != "" {
+		return hookURL(os.Getenv("RIO_WEBHOOK_URL"), receiver)
+	}
+	return hookURL(receiver.Spec.ReceiverURL, receiver)
+}
+
+func hookURL(base string, receiver *webhookv1.GitWatcher) string {
+	return fmt.Sprintf("%s/%s%s:%s", base, HooksEndpointPrefix, receiver.Namespace, receiver.Name)
+}
@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeGitCommits struct {
+	v1.GitCommitController
+	created []*webhookv1.GitCommit
+}
+
+func (f *fakeGitCommits) Create(obj *webhookv1.GitCommit) (*webhookv1.GitCommit, error) {
+	obj = obj.DeepCopy()
+	if obj.Name == "" {
+		obj.Name = obj.GenerateName + "generated"
+	}
+	if _, err := f.Get(obj.Namespace, obj.Name, metav1.GetOptions{}); err == nil {
+		return nil, errors.NewAlreadyExists(webhookv1.Resource("gitcommits"), obj.Name)
+	}
+	f.created = append(f.created, obj)
+	return obj, nil
+}
+
+func (f *fakeGitCommits) Get(namespace, name string, options metav1.GetOptions) (*webhookv1.GitCommit, error) {
+	for _, existing := range f.created {
+		if existing.Namespace == namespace && existing.Name == name {
+			return existing, nil
+		}
+	}
+	return nil, errors.NewNotFound(webhookv1.Resource("gitcommits"), name)
+}
+
+func TestGitCommitName(t *testing.T) {
+	receiver := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "watcher",
+		},
+		Spec: webhookv1.GitWatcherSpec{
+			Branch: "main",
+		},
+	}
+
+	tests := []struct {
+		name  string
+		a, b  webhookv1.GitCommitSpec
+		equal bool
+	}{
+		{
+			name:  "redelivered push",
+			a:     webhookv1.GitCommitSpec{Branch: "main", Commit: "abc", DeliveryID: "1"},
+			b:     webhookv1.GitCommitSpec{Branch: "main", Commit: "abc", DeliveryID: "2"},
+			equal: true,
+		},
+		{
+			name:  "push to the watched branch and poll",
+			a:     webhookv1.GitCommitSpec{Branch: "main", Commit: "abc", EventType: "push", DeliveryID: "1", Message: "fix"},
+			b:     webhookv1.GitCommitSpec{Branch: "main", Commit: "abc", GitWatcherName: "watcher"},
+			equal: true,
+		},
+		{
+			name: "same commit on another branch",
+			a:    webhookv1.GitCommitSpec{Branch: "main", Commit: "abc"},
+			b:    webhookv1.GitCommitSpec{Branch: "feature", Commit: "abc"},
+		},
+		{
+			name: "pull request actions",
+			a:    webhookv1.GitCommitSpec{PR: "1", Action: "opened", Commit: "abc"},
+			b:    webhookv1.GitCommitSpec{PR: "1", Action: "closed", Commit: "abc"},
+		},
+		{
+			name: "tag and push of the same commit",
+			a:    webhookv1.GitCommitSpec{Tag: "v1.0.0", Commit: "abc"},
+			b:    webhookv1.GitCommitSpec{Branch: "main", Commit: "abc"},
+		},
+		{
+			name: "reruns of the same commit",
+			a:    webhookv1.GitCommitSpec{Action: ActionRerequested, Commit: "abc", DeliveryID: "1"},
+			b:    webhookv1.GitCommitSpec{Action: ActionRerequested, Commit: "abc", DeliveryID: "2"},
+		},
+		{
+			name: "commands of the same delivery",
+			a:    webhookv1.GitCommitSpec{PR: "1", Command: "retest", Commit: "abc", DeliveryID: "1"},
+			b:    webhookv1.GitCommitSpec{PR: "1", Command: "deploy", Commit: "abc", DeliveryID: "1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := GitCommitName(receiver, &webhookv1.GitCommit{Spec: test.a})
+			b := GitCommitName(receiver, &webhookv1.GitCommit{Spec: test.b})
+			if (a == b) != test.equal {
+				t.Errorf("expected names %s and %s to be equal: %v", a, b, test.equal)
+			}
+
+			hash := strings.TrimPrefix(a, receiver.Name+"-")
+			if len(hash) != gitCommitHashLength {
+				t.Errorf("expected %s to end in a %d character hash", a, gitCommitHashLength)
+			}
+		})
+	}
+}
+
+func TestLegacyGitCommitName(t *testing.T) {
+	receiver := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "watcher",
+		},
+	}
+	execution := &webhookv1.GitCommit{Spec: webhookv1.GitCommitSpec{Commit: "abc"}}
+
+	name, legacy := GitCommitName(receiver, execution), LegacyGitCommitName(receiver, execution)
+	if !strings.HasPrefix(name, legacy) || len(legacy) != len(receiver.Name)+1+legacyGitCommitHashLength {
+		t.Errorf("expected legacy name %s to be %s cut to a %d character hash", legacy, name, legacyGitCommitHashLength)
+	}
+}
+
+func TestCreateGitCommit(t *testing.T) {
+	receiver := &webhookv1.GitWatcher{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "watcher",
+			Namespace: "default",
+		},
+	}
+	push := webhookv1.GitCommitSpec{Branch: "main", Commit: "abc"}
+
+	tests := []struct {
+		name     string
+		existing *webhookv1.GitCommitSpec
+		created  int
+	}{
+		{
+			name:    "new event",
+			created: 1,
+		},
+		{
+			name:     "redelivered event",
+			existing: &push,
+			created:  1,
+		},
+		{
+			name:     "colliding event",
+			existing: &webhookv1.GitCommitSpec{Tag: "v1.0.0", Commit: "def"},
+			created:  2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gitCommits := &fakeGitCommits{}
+			if test.existing != nil {
+				existing := NewGitCommit(receiver)
+				existing.Name = GitCommitName(receiver, &webhookv1.GitCommit{Spec: push})
+				existing.Spec = *test.existing
+				gitCommits.created = append(gitCommits.created, existing)
+			}
+
+			execution := NewGitCommit(receiver)
+			execution.Spec = push
+			if err := CreateGitCommit(context.Background(), gitCommits, nil, record.NewFakeRecorder(10), receiver, execution); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(gitCommits.created) != test.created {
+				t.Errorf("expected %d GitCommits, got %d", test.created, len(gitCommits.created))
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	"github.com/rancher/gitwatcher/pkg/git"
+)
+
+// maxChangedFiles keeps GitCommits of huge pushes well below the size limit of objects
+const maxChangedFiles = 1000
+
+// FiltersPaths returns true if receiver only creates GitCommits for pushes changing some paths
+func FiltersPaths(receiver *webhookv1.GitWatcher) bool {
+	return len(receiver.Spec.IncludePaths) > 0 || len(receiver.Spec.ExcludePaths) > 0
+}
+
+// MatchPaths records files on execution and returns an error when none of them matches the paths
+// of receiver. It does nothing for receivers that don't filter paths.
+func MatchPaths(receiver *webhookv1.GitWatcher, execution *webhookv1.GitCommit, files []string) error {
+	if !FiltersPaths(receiver) {
+		return nil
+	}
+
+	files = uniqueFiles(files)
+	if len(files) > maxChangedFiles {
+		execution.Spec.ChangedFiles = files[:maxChangedFiles]
+	} else {
+		execution.Spec.ChangedFiles = files
+	}
+
+	if !git.PathsMatch(receiver.Spec.IncludePaths, receiver.Spec.ExcludePaths, files) {
+		return fmt.Errorf("none of the %d changed files matched the paths of %s/%s", len(files), receiver.Namespace, receiver.Name)
+	}
+	return nil
+}
+
+func uniqueFiles(files []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, file := range files {
+		if file == "" || seen[file] {
+			continue
+		}
+		seen[file] = true
+		result = append(result, file)
+	}
+	sort.Strings(result)
+	return result
+}
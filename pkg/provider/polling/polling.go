@@ -3,16 +3,22 @@ package polling
 import (
 	"context"
 	"net/http"
+	"time"
 
 	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	v1 "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io/v1"
 	"github.com/rancher/gitwatcher/pkg/git"
+	"github.com/rancher/gitwatcher/pkg/metrics"
+	"github.com/rancher/gitwatcher/pkg/provider"
 	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
 	v12 "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
 	"github.com/rancher/wrangler/pkg/apply"
-	"github.com/rancher/wrangler/pkg/name"
 	"github.com/rancher/wrangler/pkg/objectset"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
@@ -21,17 +27,23 @@ var (
 
 const (
 	defaultSecretName = "gitcredential"
+	// minPollInterval keeps the status update recording a poll from triggering the next one right away
+	minPollInterval = 15 * time.Second
 )
 
 type Polling struct {
-	secretCache corev1controller.SecretCache
-	apply       apply.Apply
+	secretCache    corev1controller.SecretCache
+	gitCommitCache v1.GitCommitCache
+	apply          apply.Apply
+	recorder       record.EventRecorder
 }
 
-func NewPolling(secrets v12.SecretCache, apply apply.Apply) *Polling {
+func NewPolling(secrets v12.SecretCache, gitCommitCache v1.GitCommitCache, apply apply.Apply, recorder record.EventRecorder) *Polling {
 	return &Polling{
-		secretCache: secrets,
-		apply:       apply.WithStrictCaching(),
+		secretCache:    secrets,
+		gitCommitCache: gitCommitCache,
+		apply:          apply.WithStrictCaching(),
+		recorder:       recorder,
 	}
 }
 
@@ -44,6 +56,17 @@ func (w *Polling) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webho
 		auth git.Auth
 	)
 
+	if err := git.BranchMatch(obj.Spec.BranchInclude, obj.Spec.BranchExclude, obj.Spec.Branch); err != nil {
+		obj = obj.DeepCopy()
+		webhookv1.GitWatcherConditionReady.SetError(obj, "BranchFiltered", err)
+		return obj, nil
+	}
+
+	now := time.Now()
+	if last, err := time.Parse(time.RFC3339, obj.Status.LastPolledTime); err == nil && now.Sub(last) < minPollInterval {
+		return obj, nil
+	}
+
 	secretName := defaultSecretName
 	if obj.Spec.RepositoryCredentialSecretName != "" {
 		secretName = obj.Spec.RepositoryCredentialSecretName
@@ -60,29 +83,86 @@ func (w *Polling) Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webho
 	}
 
 	commit, err := git.BranchCommit(ctx, obj.Spec.RepositoryURL, obj.Spec.Branch, &auth)
+	metrics.ObservePoll(obj.Namespace, obj.Name, now, err)
+	obj = obj.DeepCopy()
+	obj.Status.LastPolledTime = now.Format(time.RFC3339)
 	if err != nil {
+		w.recorder.Eventf(obj, corev1.EventTypeWarning, provider.EventPollFailed, "Failed to read branch %s of %s: %v", obj.Spec.Branch, obj.Spec.RepositoryURL, err)
+		webhookv1.GitWatcherConditionReady.SetError(obj, "PollFailed", err)
 		return obj, err
 	}
 
-	err = ApplyCommit(obj, commit, w.apply)
-	if err != nil {
-		return obj, err
+	previous := obj.Status.LastPolledCommit
+	obj.Status.LastPolledCommit = commit
+	gitCommit := newCommit(obj, commit)
+	if provider.FiltersPaths(obj) {
+		if commit == previous {
+			// the paths commit changed were checked by an earlier poll already
+			webhookv1.GitWatcherConditionReady.SetError(obj, "", nil)
+			return obj, nil
+		}
+		files, err := git.ChangedFiles(ctx, obj.Spec.RepositoryURL, previous, commit, &auth)
+		if err != nil {
+			// previous may be gone after a force push, better to create a GitCommit than to miss a change
+			logrus.Warnf("Failed to diff %s and %s of %s, not filtering paths: %v", previous, commit, obj.Spec.RepositoryURL, err)
+		} else if err := provider.MatchPaths(obj, gitCommit, files); err != nil {
+			logrus.Debugf("Skipping commit %s of %s/%s: %v", commit, obj.Namespace, obj.Name, err)
+			webhookv1.GitWatcherConditionReady.SetError(obj, "", nil)
+			return obj, nil
+		}
+	}
+
+	// a GitCommit named by an earlier release already records commit, don't create another one
+	legacy, err := w.gitCommitCache.Get(obj.Namespace, provider.LegacyGitCommitName(obj, gitCommit))
+	recorded := err == nil && legacy.Spec.Commit == commit && legacy.Spec.Branch == obj.Spec.Branch
+
+	created := false
+	if !recorded {
+		_, err = w.gitCommitCache.Get(obj.Namespace, CommitName(obj, commit))
+		created = errors.IsNotFound(err)
+		if err := applyCommit(obj, gitCommit, w.apply); err != nil {
+			webhookv1.GitWatcherConditionReady.SetError(obj, "PollFailed", err)
+			return obj, err
+		}
+	}
+	if created {
+		metrics.GitCommitsCreated.WithLabelValues("poll").Inc()
+		w.recorder.Eventf(obj, corev1.EventTypeNormal, provider.EventNewCommit, "Detected commit %s on branch %s", commit, obj.Spec.Branch)
 	}
 
 	if obj.Status.FirstCommit == "" {
-		obj = obj.DeepCopy()
 		obj.Status.FirstCommit = commit
 	}
-
+	webhookv1.GitWatcherConditionReady.SetError(obj, "", nil)
 	return obj, nil
 }
 
+func (w *Polling) Remove(ctx context.Context, obj *webhookv1.GitWatcher) error {
+	return nil
+}
+
 func (w *Polling) HandleHook(ctx context.Context, req *http.Request) (int, error) {
 	return 0, nil
 }
 
+// CommitName is the name of the GitCommit ApplyCommit creates for commit
+func CommitName(obj *webhookv1.GitWatcher, commit string) string {
+	return provider.GitCommitName(obj, newCommit(obj, commit))
+}
+
 func ApplyCommit(obj *webhookv1.GitWatcher, commit string, apply apply.Apply) error {
-	gitCommit := webhookv1.NewGitCommit(obj.Namespace, name.SafeConcatName(obj.Name, name.Hex(commit, 5)), webhookv1.GitCommit{
+	return applyCommit(obj, newCommit(obj, commit), apply)
+}
+
+func applyCommit(obj *webhookv1.GitWatcher, gitCommit *webhookv1.GitCommit, apply apply.Apply) error {
+	gitCommit.Name = provider.GitCommitName(obj, gitCommit)
+	os := objectset.NewObjectSet()
+	os.Add(gitCommit)
+	return apply.WithSetID("gitcommit").WithOwner(obj).WithNoDelete().Apply(os)
+}
+
+func newCommit(obj *webhookv1.GitWatcher, commit string) *webhookv1.GitCommit {
+	return webhookv1.NewGitCommit(obj.Namespace, "", webhookv1.GitCommit{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: obj.Spec.ExecutionLabels,
 			OwnerReferences: []metav1.OwnerReference{
@@ -102,7 +182,4 @@ func ApplyCommit(obj *webhookv1.GitWatcher, commit string, apply apply.Apply) er
 			GitWatcherName: obj.Name,
 		},
 	})
-	os := objectset.NewObjectSet()
-	os.Add(gitCommit)
-	return apply.WithSetID("gitcommit").WithOwner(obj).WithNoDelete().Apply(os)
 }
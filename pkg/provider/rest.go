@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RESTClient sends JSON requests to the REST API of a git provider, the clients of the providers
+// only add their endpoints to it
+type RESTClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Authorize sets the credentials of a request
+	Authorize func(req *http.Request)
+	// Query is added to every request, such as the API version
+	Query url.Values
+}
+
+// NewRESTClient creates a RESTClient for the API served at baseURL
+func NewRESTClient(httpClient *http.Client, baseURL string, authorize func(req *http.Request)) *RESTClient {
+	return &RESTClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: httpClient,
+		Authorize:  authorize,
+	}
+}
+
+// Do sends body as JSON to path and decodes the response into out. It returns an error unless the
+// API answered with one of the expected status codes.
+func (c *RESTClient) Do(ctx context.Context, method, path string, body, out interface{}, expected ...int) error {
+	var reqBody []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = data
+	}
+
+	reqURL := c.BaseURL + path
+	if len(c.Query) > 0 {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		reqURL += sep + c.Query.Encode()
+	}
+
+	req, err := http.NewRequest(method, reqURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if c.Authorize != nil {
+		c.Authorize(req)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read api response, error: %v", err)
+	}
+	if !expectedStatus(resp.StatusCode, expected) {
+		return fmt.Errorf("%s %s failed, code: %v, error: %s", method, path, resp.StatusCode, data)
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func expectedStatus(code int, expected []int) bool {
+	for _, e := range expected {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRESTClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "token secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Query().Get("api-version") != "5.1":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == http.MethodPost && r.Header.Get("Content-Type") != "application/json":
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+		case r.URL.Path == "/api/missing":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprintf(w, `{"id": %q}`, r.URL.Query().Get("id"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewRESTClient(server.Client(), server.URL+"/api/", func(req *http.Request) {
+		req.Header.Set("Authorization", "token secret")
+	})
+	client.Query = url.Values{"api-version": {"5.1"}}
+
+	result := struct {
+		ID string `json:"id"`
+	}{}
+	if err := client.Do(context.Background(), http.MethodPost, "/hooks?id=1", map[string]string{"url": "https://example.com"}, &result, http.StatusOK); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.ID != "1" {
+		t.Errorf("expected the response to be decoded, got %+v", result)
+	}
+
+	if err := client.Do(context.Background(), http.MethodDelete, "/missing", nil, nil, http.StatusNoContent, http.StatusNotFound); err != nil {
+		t.Errorf("expected a listed status code to be accepted, got %v", err)
+	}
+	if err := client.Do(context.Background(), http.MethodGet, "/missing", nil, nil, http.StatusOK); err == nil {
+		t.Error("expected an unlisted status code to fail")
+	}
+}
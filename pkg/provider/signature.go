@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ValidateHMAC checks signature against the HMAC of payload keyed with secret. The signature
+// is either a bare hex sha256 digest or prefixed with its algorithm, as in "sha256=<hex>".
+func ValidateHMAC(payload []byte, secret, signature string) error {
+	if secret == "" {
+		return errors.New("webhook secret is not set")
+	}
+	if signature == "" {
+		return errors.New("missing webhook signature")
+	}
+
+	hashFunc := sha256.New
+	if i := strings.Index(signature, "="); i >= 0 {
+		switch signature[:i] {
+		case "sha1":
+			hashFunc = sha1.New
+		case "sha256":
+		default:
+			return fmt.Errorf("unsupported signature algorithm %s", signature[:i])
+		}
+		signature = signature[i+1:]
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid webhook signature: %v", err)
+	}
+
+	if !hmac.Equal(expected, computeHMAC(hashFunc, payload, secret)) {
+		return errors.New("webhook signature does not match")
+	}
+	return nil
+}
+
+func computeHMAC(hashFunc func() hash.Hash, payload []byte, secret string) []byte {
+	mac := hmac.New(hashFunc, []byte(secret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+)
+
+// ReasonDeliveryFailed is the reason of the Ready condition of a GitWatcher whose last delivery
+// could not be handled
+const ReasonDeliveryFailed = "DeliveryFailed"
+
+// DeliveryResult is the outcome of a delivery handled for a GitWatcher
+type DeliveryResult struct {
+	Code int
+	Err  error
+	// ValidationFailed is set for deliveries rejected as invalid
+	ValidationFailed bool
+	Time             time.Time
+}
+
+// NewDeliveryResult returns the outcome of the delivery handled with ctx
+func NewDeliveryResult(ctx context.Context, code int, err error, now time.Time) DeliveryResult {
+	return DeliveryResult{
+		Code:             code,
+		Err:              err,
+		ValidationFailed: ValidationFailed(ctx),
+		Time:             now,
+	}
+}
+
+// SetDeliveryResult records result in the status of obj. A delivery that failed on our end marks obj
+// not ready until one succeeds, deliveries rejected as invalid leave readiness alone.
+func SetDeliveryResult(obj *webhookv1.GitWatcher, result DeliveryResult) *webhookv1.GitWatcher {
+	obj = obj.DeepCopy()
+	obj.Status.LastWebhookDeliveryTime = result.Time.Format(time.RFC3339)
+	obj.Status.LastWebhookDeliveryResult = deliveryResult(result.Code, result.Err)
+
+	switch {
+	case result.ValidationFailed:
+	case result.Code >= http.StatusInternalServerError && result.Err != nil:
+		webhookv1.GitWatcherConditionReady.SetError(obj, ReasonDeliveryFailed, result.Err)
+	case result.Code < http.StatusBadRequest && webhookv1.GitWatcherConditionReady.GetReason(obj) == ReasonDeliveryFailed:
+		webhookv1.GitWatcherConditionReady.SetError(obj, "", nil)
+	}
+	return obj
+}
+
+func deliveryResult(code int, err error) string {
+	result := fmt.Sprintf("%d %s", code, http.StatusText(code))
+	if err != nil {
+		result += ": " + err.Error()
+	}
+	return result
+}
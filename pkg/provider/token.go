@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+)
+
+// TokenGracePeriod is how long the previous webhook token is accepted after a rotation
+const TokenGracePeriod = time.Hour
+
+// TokenRotator is implemented by providers that can replace the secret of a registered hook
+type TokenRotator interface {
+	RotateToken(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error)
+}
+
+// RotationDue reports whether obj asks for a new token, either through the rotate annotation or
+// because its rotation interval elapsed
+func RotationDue(obj *webhookv1.GitWatcher, now time.Time) (bool, error) {
+	if obj.Status.Token == "" {
+		return false, nil
+	}
+
+	request := obj.Annotations[webhookv1.GitWatcherRotateTokenAnnotation]
+	if request != "" && request != obj.Status.TokenRotationRequest {
+		return true, nil
+	}
+
+	next, err := nextRotation(obj)
+	if err != nil || next.IsZero() {
+		return false, err
+	}
+	return !now.Before(next), nil
+}
+
+// RotateToken replaces the token of obj, keeping the current one as the previous token for the grace period
+func RotateToken(obj *webhookv1.GitWatcher, now time.Time) *webhookv1.GitWatcher {
+	obj = obj.DeepCopy()
+	obj.Status.PreviousToken = obj.Status.Token
+	obj.Status.PreviousTokenExpiry = now.Add(TokenGracePeriod).Format(time.RFC3339)
+	obj.Status.Token = uuid.New().String()
+	obj.Status.TokenRotated = now.Format(time.RFC3339)
+	obj.Status.TokenRotationRequest = obj.Annotations[webhookv1.GitWatcherRotateTokenAnnotation]
+	return obj
+}
+
+// ExpirePreviousToken drops the previous token of obj once its grace period is over
+func ExpirePreviousToken(obj *webhookv1.GitWatcher, now time.Time) *webhookv1.GitWatcher {
+	if obj.Status.PreviousToken == "" || previousTokenValid(obj, now) {
+		return obj
+	}
+
+	obj = obj.DeepCopy()
+	obj.Status.PreviousToken = ""
+	obj.Status.PreviousTokenExpiry = ""
+	return obj
+}
+
+// ValidTokens returns the tokens deliveries for obj may be signed with, current token first
+func ValidTokens(obj *webhookv1.GitWatcher, now time.Time) []string {
+	var tokens []string
+	if obj.Status.Token != "" {
+		tokens = append(tokens, obj.Status.Token)
+	}
+	if obj.Status.PreviousToken != "" && previousTokenValid(obj, now) {
+		tokens = append(tokens, obj.Status.PreviousToken)
+	}
+	return tokens
+}
+
+// NextTokenChange returns how long until the previous token of obj expires or its next scheduled
+// rotation, zero when neither is pending
+func NextTokenChange(obj *webhookv1.GitWatcher, now time.Time) time.Duration {
+	var next time.Time
+	if expiry, err := time.Parse(time.RFC3339, obj.Status.PreviousTokenExpiry); err == nil {
+		next = expiry
+	}
+	if rotation, err := nextRotation(obj); err == nil && !rotation.IsZero() && (next.IsZero() || rotation.Before(next)) {
+		next = rotation
+	}
+	if next.IsZero() {
+		return 0
+	}
+	if d := next.Sub(now); d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+func nextRotation(obj *webhookv1.GitWatcher) (time.Time, error) {
+	if obj.Spec.TokenRotationInterval == "" {
+		return time.Time{}, nil
+	}
+
+	interval, err := time.ParseDuration(obj.Spec.TokenRotationInterval)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid token rotation interval %s: %v", obj.Spec.TokenRotationInterval, err)
+	}
+	if interval <= 0 {
+		return time.Time{}, nil
+	}
+
+	last := obj.CreationTimestamp.Time
+	if rotated, err := time.Parse(time.RFC3339, obj.Status.TokenRotated); err == nil {
+		last = rotated
+	}
+	return last.Add(interval), nil
+}
+
+func previousTokenValid(obj *webhookv1.GitWatcher, now time.Time) bool {
+	expiry, err := time.Parse(time.RFC3339, obj.Status.PreviousTokenExpiry)
+	return err == nil && now.Before(expiry)
+}
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+
+	webhookv1 "github.com/rancher/gitwatcher/pkg/apis/gitwatcher.cattle.io/v1"
+	corev1controller "github.com/rancher/wrangler-api/pkg/generated/controllers/core/v1"
+	"github.com/rancher/wrangler/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	TokenSecretKey         = "token"
+	PreviousTokenSecretKey = "previousToken"
+)
+
+// TokenSecretName is the name of the Secret holding the webhook tokens of obj, unless a Secret of that
+// name was created by someone else
+func TokenSecretName(obj *webhookv1.GitWatcher) string {
+	return name.SafeConcatName(obj.Name, "webhook-token")
+}
+
+// LoadTokens returns a copy of obj with Status.Token and Status.PreviousToken read from its token
+// Secret, watchers that still carry an inline token are returned as they are
+func LoadTokens(secretCache corev1controller.SecretCache, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.TokenSecretName == "" || obj.Status.Token != "" {
+		return obj, nil
+	}
+
+	secret, err := secretCache.Get(obj.Namespace, obj.Status.TokenSecretName)
+	if err != nil {
+		return obj, fmt.Errorf("failed to get webhook token secret %s/%s: %v", obj.Namespace, obj.Status.TokenSecretName, err)
+	}
+
+	obj = obj.DeepCopy()
+	obj.Status.Token = string(secret.Data[TokenSecretKey])
+	obj.Status.PreviousToken = string(secret.Data[PreviousTokenSecretKey])
+	return obj, nil
+}
+
+// SaveTokens writes the tokens of obj to a Secret owned by obj and returns a copy of obj without them,
+// so they can't be read by anyone allowed to read GitWatchers
+func SaveTokens(secrets corev1controller.SecretController, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error) {
+	if obj.Status.Token == "" && obj.Status.PreviousToken == "" {
+		return obj, nil
+	}
+
+	data := map[string][]byte{
+		TokenSecretKey: []byte(obj.Status.Token),
+	}
+	if obj.Status.PreviousToken != "" {
+		data[PreviousTokenSecretKey] = []byte(obj.Status.PreviousToken)
+	}
+
+	secretName, secret, err := tokenSecret(secrets, obj)
+	if err != nil {
+		return obj, err
+	}
+	if secret == nil {
+		_, err = secrets.Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: obj.Namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: webhookv1.SchemeGroupVersion.String(),
+						Kind:       "GitWatcher",
+						Name:       obj.Name,
+						UID:        obj.UID,
+					},
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		})
+	} else if !sameData(secret.Data, data) {
+		secret = secret.DeepCopy()
+		secret.Data = data
+		_, err = secrets.Update(secret)
+	}
+	if err != nil {
+		return obj, fmt.Errorf("failed to save webhook token secret %s/%s: %v", obj.Namespace, secretName, err)
+	}
+
+	obj = obj.DeepCopy()
+	obj.Status.Token = ""
+	obj.Status.PreviousToken = ""
+	obj.Status.TokenSecretName = secretName
+	return obj, nil
+}
+
+// tokenSecret returns the name of the Secret to keep the tokens of obj in, along with the Secret when it
+// exists already. A Secret of that name created by someone else is left alone for one named after the
+// UID of obj.
+func tokenSecret(secrets corev1controller.SecretController, obj *webhookv1.GitWatcher) (string, *corev1.Secret, error) {
+	names := []string{
+		TokenSecretName(obj),
+		name.SafeConcatName(obj.Name, "webhook-token", name.Hex(string(obj.UID), 8)),
+	}
+	if obj.Status.TokenSecretName != "" {
+		names = append([]string{obj.Status.TokenSecretName}, names...)
+	}
+
+	for _, secretName := range names {
+		secret, err := secrets.Get(obj.Namespace, secretName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return secretName, nil, nil
+		} else if err != nil {
+			return secretName, nil, fmt.Errorf("failed to get webhook token secret %s/%s: %v", obj.Namespace, secretName, err)
+		}
+		if ownedBy(secret, obj) {
+			return secretName, secret, nil
+		}
+	}
+	return "", nil, fmt.Errorf("webhook token secrets %v in %s exist and are not owned by gitwatcher %s", names, obj.Namespace, obj.Name)
+}
+
+// ownedBy reports whether secret was created for obj, so its data may be overwritten
+func ownedBy(secret *corev1.Secret, obj *webhookv1.GitWatcher) bool {
+	for _, owner := range secret.OwnerReferences {
+		if owner.UID == obj.UID {
+			return true
+		}
+	}
+	return false
+}
+
+func sameData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if !bytes.Equal(v, b[k]) {
+			return false
+		}
+	}
+	return true
+}
@@ -10,5 +10,12 @@ import (
 type Provider interface {
 	Supports(obj *webhookv1.GitWatcher) bool
 	Create(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error)
+	Remove(ctx context.Context, obj *webhookv1.GitWatcher) error
 	HandleHook(ctx context.Context, req *http.Request) (int, error)
 }
+
+// HookReconciler is implemented by providers that can repair a registered hook which drifted
+// from the GitWatcher spec or was deleted on the remote repository
+type HookReconciler interface {
+	Reconcile(ctx context.Context, obj *webhookv1.GitWatcher) (*webhookv1.GitWatcher, error)
+}
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"context"
+)
+
+type validationKey struct{}
+
+type validation struct {
+	skip      bool
+	only      bool
+	validated bool
+	failed    bool
+	event     string
+	// credentialHeaders carry the GitWatcher token itself rather than a signature
+	credentialHeaders []string
+}
+
+// WithValidation returns a context that records whether a provider validated the delivery it handled
+func WithValidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, validationKey{}, &validation{})
+}
+
+// WithValidateOnly returns a context in which providers stop handling a delivery as soon as it
+// validated, answering http.StatusAccepted so it can be handled later
+func WithValidateOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, validationKey{}, &validation{
+		only: true,
+	})
+}
+
+// ValidateOnly reports whether the delivery handled with ctx should only be validated
+func ValidateOnly(ctx context.Context) bool {
+	v, ok := ctx.Value(validationKey{}).(*validation)
+	return ok && v.only
+}
+
+// WithoutValidation returns a context for a delivery that was validated when it was received, such as
+// a replay, providers handle it without checking its signature again
+func WithoutValidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, validationKey{}, &validation{
+		skip: true,
+	})
+}
+
+// ValidationSkipped reports whether the delivery handled with ctx was validated already
+func ValidationSkipped(ctx context.Context) bool {
+	v, ok := ctx.Value(validationKey{}).(*validation)
+	return ok && v.skip
+}
+
+// MarkValidated records that the delivery handled with ctx passed validation
+func MarkValidated(ctx context.Context) {
+	if v, ok := ctx.Value(validationKey{}).(*validation); ok {
+		v.validated = true
+	}
+}
+
+// Validated reports whether a provider validated the delivery handled with ctx
+func Validated(ctx context.Context) bool {
+	v, ok := ctx.Value(validationKey{}).(*validation)
+	return ok && (v.validated || v.skip)
+}
+
+// MarkValidationFailed records that the delivery handled with ctx failed validation
+func MarkValidationFailed(ctx context.Context) {
+	if v, ok := ctx.Value(validationKey{}).(*validation); ok {
+		v.failed = true
+	}
+}
+
+// ValidationFailed reports whether a provider rejected the delivery handled with ctx as invalid
+func ValidationFailed(ctx context.Context) bool {
+	v, ok := ctx.Value(validationKey{}).(*validation)
+	return ok && v.failed
+}
+
+// MarkCredentialHeader records that header of the delivery handled with ctx carries a credential,
+// such as the GitWatcher token, so it isn't kept anywhere
+func MarkCredentialHeader(ctx context.Context, header string) {
+	if v, ok := ctx.Value(validationKey{}).(*validation); ok {
+		v.credentialHeaders = append(v.credentialHeaders, header)
+	}
+}
+
+// CredentialHeaders returns the headers of the delivery handled with ctx providers marked as credentials
+func CredentialHeaders(ctx context.Context) []string {
+	if v, ok := ctx.Value(validationKey{}).(*validation); ok {
+		return v.credentialHeaders
+	}
+	return nil
+}
+
+// EventType returns the event type of the delivery handled with ctx, once a provider recognized it
+func EventType(ctx context.Context) string {
+	if v, ok := ctx.Value(validationKey{}).(*validation); ok {
+		return v.event
+	}
+	return ""
+}
+
+// Validate runs check unless validation is skipped for ctx, and records its outcome
+func Validate(ctx context.Context, check func() error) error {
+	if !ValidationSkipped(ctx) {
+		if err := check(); err != nil {
+			MarkValidationFailed(ctx)
+			return err
+		}
+	}
+	MarkValidated(ctx)
+	return nil
+}
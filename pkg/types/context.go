@@ -3,12 +3,16 @@ package types
 import (
 	"context"
 
+	"github.com/rancher/gitwatcher/pkg/generated/clientset/versioned/scheme"
 	webhook "github.com/rancher/gitwatcher/pkg/generated/controllers/gitwatcher.cattle.io"
 	"github.com/rancher/wrangler-api/pkg/generated/controllers/core"
 	"github.com/rancher/wrangler/pkg/apply"
 	"github.com/rancher/wrangler/pkg/start"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
 type contextKey struct{}
@@ -21,6 +25,8 @@ type Context struct {
 	K8s     kubernetes.Interface
 
 	Apply apply.Apply
+	// Recorder records Events on GitWatchers and GitCommits
+	Recorder record.EventRecorder
 }
 
 func Store(ctx context.Context, c *Context) context.Context {
@@ -40,6 +46,14 @@ func NewContext(namespace string, config *rest.Config) *Context {
 	}
 
 	context.Apply = apply.New(context.K8s.Discovery(), apply.NewClientFactory(config))
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: context.K8s.CoreV1().Events(""),
+	})
+	context.Recorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{
+		Component: "gitwatcher",
+	})
 	return context
 }
 